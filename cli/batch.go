@@ -0,0 +1,193 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core"
+)
+
+var episodeNumberRegex = regexp.MustCompile(`^[0-9]+$`)
+
+// Exit codes of CliRunItem
+const (
+	ItemSuccessful = 0
+	ItemFailed     = 1
+	ItemAborted    = 130
+	ItemSkipped    = -1
+)
+
+type BatchItem struct {
+	Url        string
+	FormatName string
+	ChapterNum int
+	OutputFile string
+	// Result
+	Status int
+	Error  error
+}
+
+// Can be passed multiple times
+type UrlList []string
+
+func (l *UrlList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *UrlList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Accepts an episode number instead of an url
+func expandEpisodeUrl(url string) string {
+	if episodeNumberRegex.MatchString(url) {
+		return fmt.Sprintf(core.StreamEpisodeUrlTemplate, url)
+	}
+	return url
+}
+
+// Split a line into fields, double quotes can be used to keep spaces
+func splitBatchLine(line string) ([]string, error) {
+	fields := []string{}
+	var field strings.Builder
+	inField := false
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inField = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if quoted {
+		return fields, &GenericCliAgumentError{Msg: "missing closing quote"}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// Format of a line:
+//
+//	<url or episode number> [format=<format>] [chapter=<chapter>] [output=<file>]
+func parseBatchLine(line string) (BatchItem, error) {
+	item := BatchItem{FormatName: Arguments.FormatName, ChapterNum: Arguments.ChapterNum}
+	fields, err := splitBatchLine(line)
+	if err != nil {
+		return item, err
+	}
+	item.Url = expandEpisodeUrl(fields[0])
+	for _, f := range fields[1:] {
+		k, v, found := strings.Cut(f, "=")
+		if !found {
+			return item, &GenericCliAgumentError{Msg: "expected key=value, got '" + f + "'"}
+		}
+		switch k {
+		case "format":
+			item.FormatName = v
+		case "chapter":
+			item.ChapterNum, err = strconv.Atoi(v)
+			if err != nil {
+				return item, &GenericCliAgumentError{Msg: "invalid chapter '" + v + "'"}
+			}
+		case "output":
+			item.OutputFile = v
+			if err := cliCheckOutputFile(v); err != nil {
+				return item, err
+			}
+		default:
+			return item, &GenericCliAgumentError{Msg: "unknown option '" + k + "'"}
+		}
+	}
+	return item, nil
+}
+
+func readBatchFile(filename string) ([]BatchItem, error) {
+	items := []BatchItem{}
+	f, err := os.Open(filename)
+	if err != nil {
+		return items, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		item, err := parseBatchLine(line)
+		if err != nil {
+			return items, &GenericCliAgumentError{Msg: fmt.Sprintf("%v, line %v: %v", filename, lineNum, err)}
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
+
+// All items from --url and --batch-file
+func CliBatchItems() ([]BatchItem, error) {
+	items := []BatchItem{}
+	for _, url := range Arguments.Urls {
+		items = append(items, BatchItem{
+			Url:        expandEpisodeUrl(url),
+			FormatName: Arguments.FormatName,
+			ChapterNum: Arguments.ChapterNum,
+			OutputFile: Arguments.OutputFile,
+		})
+	}
+	if Arguments.BatchFile != "" {
+		fileItems, err := readBatchFile(Arguments.BatchFile)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, fileItems...)
+	}
+	if len(items) > 1 && Arguments.OutputFile != "" {
+		return items, &GenericCliAgumentError{Msg: "--output can't be used with multiple videos, use output=<file> in the batch file instead"}
+	}
+	return items, nil
+}
+
+func CliBatchSummary(items []BatchItem) {
+	fmt.Print("\n\nSummary:\n")
+	for i, item := range items {
+		var status string
+		switch item.Status {
+		case ItemSuccessful:
+			status = "done"
+		case ItemAborted:
+			status = "aborted"
+		case ItemSkipped:
+			status = "skipped"
+		default:
+			status = "failed"
+		}
+		fmt.Printf("%4d  %-8s %s", i+1, status, item.Url)
+		if item.OutputFile != "" {
+			fmt.Printf(" -> %s", item.OutputFile)
+		}
+		if item.Error != nil {
+			fmt.Printf("\n                %v", item.Error)
+		}
+		fmt.Print("\n")
+	}
+}
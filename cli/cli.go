@@ -3,9 +3,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +18,7 @@ import (
 
 // Global Variables
 var CliXtermTitle bool
+var CliVideoOutput = os.Stdout // for --output -
 
 //
 
@@ -38,7 +43,8 @@ func XtermSetTitle(title string) {
 // Commandline
 
 var Arguments struct {
-	Url string `json:"url"`
+	Urls UrlList `json:"urls"`
+	BatchFile string `json:"batch_file"`
 	FormatName string `json:"format_name"`
 	OutputFile string `json:"output_file"`
 	TimestampStart string `json:"timestamp_start"`
@@ -50,33 +56,115 @@ var Arguments struct {
 	VideoInfo bool `json:"-"`
 	ListFormats bool `json:"-"`
 	ChapterNum   int  `json:"chapter_num"`
+	ChapterList string `json:"chapters"`
+	SplitChapters bool `json:"split_chapters"`
 	// Parsed
 	StartDuration time.Duration `json:"-"`
 	StopDuration time.Duration `json:"-"`
+	Chapters []int `json:"-"`
 	Ratelimit float64 `json:"-"`
+	Connections int `json:"connections"`
+	NoPartFile bool `json:"no_part"`
+	PreciseCut bool `json:"precise"`
+	NoValidation bool `json:"no_validate"`
+	Container string `json:"container"`
+	Layout string `json:"layout"`
+	AudioOnly bool `json:"audio_only"`
+	PreferHevc bool `json:"prefer_hevc"`
+	Retries int `json:"retries"`
+	RetryDelay time.Duration `json:"retry_delay"`
+	RetryMaxDelay time.Duration `json:"retry_max_delay"`
+	RetryPolicy core.RetryPolicy `json:"-"` // also used for metadata requests
 }
 
 func CliShowHelp() {
 	fmt.Println(`
-lurch-dl --url string       The url to the video
+lurch-dl --url string       The url to the video or the episode number,
+                            can be passed multiple times. Live streams
+                            (https://gronkh.tv/live) and episodes that are
+                            still being streamed are downloaded until the
+                            stream ends or the download is stopped with
+                            Ctrl+C, they can't be continued or cut.
+         [--batch-file string]
+                            A file with one url or episode number per line,
+                            optionally followed by format=<format>,
+                            chapter=<int> and output=<file>, e.g.
+                              777 chapter=2 output="Chapter 2.ts"
+                            Lines starting with # are ignored.
          [-h --help]        Show this help and exit
          [--info]           Show video info (chapters, formats, length, ...)
          [--chapter int]    The chapter you want to download
                             The calculated start and stop timestamps can be
                             overwritten by --start and --stop
                             default: 0 (complete stream)
-         [--format string]  The desired video format
-                            default: auto
+         [--chapters string]
+                            Download the selected chapters into separate
+                            files, e.g. 2,4-6
+         [--split-chapters] Download all chapters into separate files
+         [--format string]  The desired video format: a name or an
+                            expression like best, worst, <=720p, 720p30,
+                            fps>=50, bw<3M or codec=hevc. Conditions can be
+                            combined with &, fallbacks are separated by /,
+                            e.g. 720p30/<=720p/worst. The best matching
+                            format is chosen. Several formats can be
+                            mirrored with --layout hls, e.g. 1080p60,720p
+                            default: auto (the same as best)
+         [--prefer-hevc]    Prefer HEVC (H.265) formats over H.264 formats
+                            when a format is chosen by an expression
          [--output string]  The output file. Will be determined automatically
-                            if omitted.
+                            if omitted. Use - to write the video to stdout,
+                            e.g. to pipe it into a video player.
          [--start string]   Define a video timestamp to start at, e.g. 12m34s
          [--stop string]    Define a video timestamp to stop at, e.g. 1h23m45s
+         [--precise]        Cut the video at the exact start and stop
+                            timestamps (also of chapters) instead of whole
+                            chunks. The video starts at the last keyframe
+                            before the start timestamp.
+         [--container string]
+                            The container of the output file, ts, mkv or
+                            mp4 (fragmented), no ffmpeg needed. mkv files
+                            are remuxed when the download is finished, mp4
+                            files are written while downloading. aac and
+                            m4a only contain the audio.
+                            default: ts
+         [--audio-only]     Only save the audio, as m4a file with chapter
+                            markers, or as aac file with --container aac
+         [--layout string]  file or hls - hls saves the video chunks as
+                            separate files next to a playlist for video
+                            players, into a directory named like the
+                            output file. Can't be combined with --precise.
+                            default: file
+         [--no-validate]    Don't check downloaded chunks for damage, e.g.
+                            truncated or garbage data. Damaged chunks are
+                            downloaded again.
          [--continue]       Continue the download if possible
          [--overwrite]      Overwrite the output file if it already exists
+         [--no-part]        Write directly into the output file instead of
+                            a .part file that is renamed when the download
+                            is finished, e.g. to watch while downloading
          [--max-rate float] The maximum download rate in MB/s - don't set this
                             too high, you may run into a ratelimit and your
                             IP address might get banned from the servers.
                             default: 16.0
+         [--connections int]
+                            The number of chunks to download in parallel.
+                            The download rate stays limited by --max-rate.
+                            default: 1
+         [--retries int]    How often a failed request is retried
+                            default: 5
+         [--retry-delay duration]
+                            The delay before the first retry, doubles with
+                            every further retry
+                            default: 500ms
+         [--retry-max-delay duration]
+                            The maximum delay between two retries
+                            default: 30s
+
+lurch-dl serve [--help]     Start a local HLS server to watch episodes in a
+                            video player, see lurch-dl serve --help
+
+lurch-dl verify [--help]    Check downloaded files for damage, see
+                            lurch-dl verify --help
 
 Version: ` + Version)
 }
@@ -87,15 +175,29 @@ func CliParseArguments() error {
 	flag.BoolVar(&Arguments.Help, "h", false, "")
 	flag.BoolVar(&Arguments.Help, "help", false, "")
 	flag.BoolVar(&Arguments.VideoInfo, "info", false, "")
-	flag.StringVar(&Arguments.Url, "url", "", "")
+	flag.Var(&Arguments.Urls, "url", "")
+	flag.StringVar(&Arguments.BatchFile, "batch-file", "", "")
 	flag.IntVar(&Arguments.ChapterNum, "chapter", 0, "") // 0 -> chapter idx -1 -> complete stream
-	flag.StringVar(&Arguments.FormatName, "format", "auto", "")
+	flag.StringVar(&Arguments.ChapterList, "chapters", "", "")
+	flag.BoolVar(&Arguments.SplitChapters, "split-chapters", false, "")
+	flag.StringVar(&Arguments.FormatName, "format", core.FormatAuto, "")
+	flag.BoolVar(&Arguments.PreferHevc, "prefer-hevc", false, "")
 	flag.StringVar(&Arguments.OutputFile, "output", "", "")
 	flag.StringVar(&Arguments.TimestampStart, "start", "", "")
 	flag.StringVar(&Arguments.TimestampStop, "stop", "", "")
 	flag.BoolVar(&Arguments.Overwrite, "overwrite", false, "")
 	flag.BoolVar(&Arguments.ContinueDl, "continue", false, "")
+	flag.BoolVar(&Arguments.NoPartFile, "no-part", false, "")
+	flag.BoolVar(&Arguments.PreciseCut, "precise", false, "")
+	flag.BoolVar(&Arguments.NoValidation, "no-validate", false, "")
+	flag.StringVar(&Arguments.Container, "container", core.ContainerTs, "")
+	flag.StringVar(&Arguments.Layout, "layout", core.LayoutFile, "")
+	flag.BoolVar(&Arguments.AudioOnly, "audio-only", false, "")
 	flag.Float64Var(&ratelimitMbs, "max-rate", 16.0, "")
+	flag.IntVar(&Arguments.Connections, "connections", 1, "")
+	flag.IntVar(&Arguments.Retries, "retries", core.MaxRetries, "")
+	flag.DurationVar(&Arguments.RetryDelay, "retry-delay", core.DefaultRetryPolicy.BaseDelay, "")
+	flag.DurationVar(&Arguments.RetryMaxDelay, "retry-max-delay", core.DefaultRetryPolicy.MaxDelay, "")
 	flag.Parse()
 	if Arguments.TimestampStart == "" {
 		Arguments.StartDuration = -1
@@ -113,16 +215,101 @@ func CliParseArguments() error {
 			return err
 		}
 	}
+	if Arguments.ChapterList != "" {
+		Arguments.Chapters, err = parseChapterList(Arguments.ChapterList)
+		if err != nil {
+			return err
+		}
+	}
+	if Arguments.SplitChapters || len(Arguments.Chapters) > 0 {
+		if Arguments.ChapterNum != 0 || Arguments.OutputFile != "" || Arguments.TimestampStart != "" || Arguments.TimestampStop != "" {
+			return &GenericCliAgumentError{Msg: "--chapters and --split-chapters can't be combined with --chapter, --output, --start or --stop"}
+		}
+	}
 	Arguments.Ratelimit = ratelimitMbs * 1_000_000.0 // MB/s -> B/s
 	if Arguments.Ratelimit <= 0 {
 		return &GenericCliAgumentError{Msg: "the value of --max-rate must be greater than 0"}
 	}
+	// before the checks of the container
+	if Arguments.AudioOnly && Arguments.Container == core.ContainerTs {
+		Arguments.Container = core.ContainerM4a
+	} else if Arguments.AudioOnly && !slices.Contains(core.AudioContainers, Arguments.Container) {
+		return &GenericCliAgumentError{Msg: "--audio-only can only be used with --container " + strings.Join(core.AudioContainers, " or ")}
+	}
+	if err := cliCheckOutputFile(Arguments.OutputFile); err != nil {
+		return err
+	}
+	if !slices.Contains(core.Layouts, Arguments.Layout) {
+		return &GenericCliAgumentError{Msg: "the value of --layout must be one of " + strings.Join(core.Layouts, ", ")}
+	}
+	if Arguments.Layout == core.LayoutHls && Arguments.Container != core.ContainerTs {
+		return &GenericCliAgumentError{Msg: "--layout hls can only be used with --container ts"}
+	}
+	if Arguments.Layout == core.LayoutHls && Arguments.PreciseCut {
+		return &GenericCliAgumentError{Msg: "--layout hls can't be used with --precise"}
+	}
+	if !slices.Contains(core.Containers, Arguments.Container) {
+		return &GenericCliAgumentError{Msg: "the value of --container must be one of " + strings.Join(core.Containers, ", ")}
+	}
+	if Arguments.Connections < 1 {
+		return &GenericCliAgumentError{Msg: "the value of --connections must be at least 1"}
+	}
+	if Arguments.Retries < 0 || Arguments.RetryDelay < 0 || Arguments.RetryMaxDelay < 0 {
+		return &GenericCliAgumentError{Msg: "the values of --retries, --retry-delay and --retry-max-delay must not be negative"}
+	}
+	Arguments.RetryPolicy = core.RetryPolicy{
+		MaxAttempts: Arguments.Retries + 1,
+		BaseDelay: Arguments.RetryDelay,
+		MaxDelay: Arguments.RetryMaxDelay,
+	}
 	return err
 }
 
+// Also checked for the output of every line of a batch file
+func cliCheckOutputFile(outputFile string) error {
+	if outputFile == "-" && (Arguments.ContinueDl || Arguments.Container == core.ContainerMkv || Arguments.Layout == core.LayoutHls) {
+		return &GenericCliAgumentError{Msg: "the output - (stdout) can't be used with --continue, --container mkv or --layout hls"}
+	}
+	return nil
+}
+
+// e.g. "2,4-6" -> [2 4 5 6]
+func parseChapterList(list string) ([]int, error) {
+	chapters := []int{}
+	invalid := &GenericCliAgumentError{Msg: "invalid value for --chapters: " + list}
+	for part := range strings.SplitSeq(list, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 1 {
+			return chapters, invalid
+		}
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(last)
+			if err != nil || to < from {
+				return chapters, invalid
+			}
+		}
+		for i := from; i <= to; i++ {
+			if !slices.Contains(chapters, i) {
+				chapters = append(chapters, i)
+			}
+		}
+	}
+	return chapters, nil
+}
+
 // Main
 
 func CliRun() int {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			return CliServe(os.Args[2:])
+		case "verify":
+			return CliVerify(os.Args[2:])
+		}
+	}
 	defer fmt.Print("\n")
 	// cli arguments & help text
 	flag.Usage = CliShowHelp
@@ -130,35 +317,77 @@ func CliRun() int {
 	if Arguments.Help {
 		CliShowHelp()
 		return 0
-	} else if Arguments.Url == "" || err != nil {
+	}
+	var items []BatchItem
+	if err == nil {
+		items, err = CliBatchItems()
+	}
+	if len(items) == 0 || err != nil {
 		CliShowHelp()
 		if err != nil {
 			CliErrorMessage(err)
 		}
 		return 1
 	}
+	for _, item := range items {
+		if item.OutputFile == "-" {
+			// the video goes to stdout, everything else to stderr
+			os.Stdout = os.Stderr
+			break
+		}
+	}
 	// detect terminal features
 	XtermDetectFeatures()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// shared by all downloads
+	limiter := core.NewRateLimiter(Arguments.Ratelimit, core.RatelimitBurst)
+	for i := range items {
+		items[i].Status = ItemSkipped
+	}
+	exitCode := ItemSuccessful
+	for i := range items {
+		if len(items) > 1 {
+			fmt.Printf("\n[%v/%v] %v", i+1, len(items), items[i].Url)
+		}
+		items[i].Status, items[i].Error = CliRunItem(ctx, &items[i], limiter)
+		if items[i].Status != ItemSuccessful {
+			exitCode = items[i].Status
+		}
+		if items[i].Status == ItemAborted {
+			break
+		}
+	}
+	if len(items) > 1 {
+		CliBatchSummary(items)
+	}
+	return exitCode
+}
+
+func CliRunItem(ctx context.Context, item *BatchItem, limiter *core.RateLimiter) (int, error) {
 	// Get video metadata
 	if CliXtermTitle {
 		XtermSetTitle("lurch-dl - Fetching video metadata ...")
 	}
-	streamEp, err := core.StreamEpisodeFromUrl(Arguments.Url)
-	if err != nil {
+	streamEp, err := core.StreamEpisodeFromUrl(ctx, item.Url, Arguments.RetryPolicy)
+	if ctx.Err() != nil {
+		fmt.Print("\nAborted.")
+		return ItemAborted, nil
+	} else if err != nil {
 		CliErrorMessage(err)
-		return 1
+		return ItemFailed, err
 	}
 	fmt.Print("\n")
 	fmt.Printf("Title:     %s\n", streamEp.Title)
 	// Check and list chapters/formats and exit
-	targetChapter, err := streamEp.ChapterByNumber(Arguments.ChapterNum)
+	targetChapter, err := streamEp.ChapterByNumber(item.ChapterNum)
 	if err != nil {
 		CliErrorMessage(err)
 		CliAvailableChapters(streamEp.Chapters)
-		return 1
+		return ItemFailed, err
 	}
-	if Arguments.ChapterNum > 0 && len(streamEp.Chapters) > 0 && targetChapter != nil {
-		fmt.Printf("Chapter:   %v. %v\n", Arguments.ChapterNum, targetChapter.Category.Title)
+	if item.ChapterNum > 0 && len(streamEp.Chapters) > 0 && targetChapter != nil {
+		fmt.Printf("Chapter:   %v. %v\n", item.ChapterNum, targetChapter.Category.Title)
 	}
 	// Video Info
 	if Arguments.VideoInfo {
@@ -180,55 +409,182 @@ func CliRun() int {
 		}
 		CliAvailableFormats(streamEp.Formats)
 		CliAvailableChapters(streamEp.Chapters)
-		return 0
+		return ItemSuccessful, nil
 	}
-	format, err := streamEp.FormatByName(Arguments.FormatName)
-	if err != nil {
+	// HLS mirrors can contain several formats, e.g. 1080p60,720p
+	formatNames := strings.Split(item.FormatName, ",")
+	if len(formatNames) > 1 && (Arguments.Layout != core.LayoutHls || Arguments.SplitChapters || len(Arguments.Chapters) > 0) {
+		err := &GenericCliAgumentError{Msg: "several formats can only be downloaded with --layout hls and not with --chapters or --split-chapters"}
 		CliErrorMessage(err)
-		CliAvailableFormats(streamEp.Formats)
-		return 1
+		return ItemFailed, err
+	}
+	for i := range formatNames {
+		format, err := streamEp.SelectFormat(strings.TrimSpace(formatNames[i]), Arguments.PreferHevc)
+		if err != nil {
+			CliErrorMessage(err)
+			CliAvailableFormats(streamEp.Formats)
+			return ItemFailed, err
+		}
+		formatNames[i] = format.Name
+	}
+	fmt.Printf("Format:    %v\n", strings.Join(formatNames, ", "))
+	item.FormatName = formatNames[0]
+	if Arguments.SplitChapters || len(Arguments.Chapters) > 0 {
+		return CliDownloadChapters(ctx, &streamEp, item, limiter)
 	}
-	fmt.Printf("Format:    %v\n", format.Name)
 	// We already set the output file correctly so we can output it
-	if Arguments.OutputFile == "" {
-		Arguments.OutputFile = streamEp.ProposeFilename(targetChapter)
+	if item.OutputFile == "" {
+		item.OutputFile = cliOutputFilename(&streamEp, targetChapter)
 	}
 	// Start Download
-	fmt.Printf("Output:    %v\n", Arguments.OutputFile)
+	fmt.Printf("Output:    %v\n", item.OutputFile)
 	fmt.Print("\n")
+	opts := core.DownloadOptions{
+		Chapter: targetChapter,
+		FormatName: item.FormatName,
+		OutputFile: item.OutputFile,
+		Overwrite: Arguments.Overwrite,
+		ContinueDl: Arguments.ContinueDl,
+		StartOffset: Arguments.StartDuration,
+		StopOffset: Arguments.StopDuration,
+		RateLimiter: limiter,
+		RetryPolicy: Arguments.RetryPolicy,
+		Connections: Arguments.Connections,
+		NoPartFile: Arguments.NoPartFile,
+		PreciseCut: Arguments.PreciseCut,
+		NoValidation: Arguments.NoValidation,
+		Container: Arguments.Container,
+		Layout: Arguments.Layout,
+	}
+	if item.OutputFile == "-" {
+		opts.Sink = &core.WriterSink{Writer: CliVideoOutput}
+	}
+	if len(formatNames) == 1 {
+		return CliDownload(ctx, &streamEp, opts)
+	}
+	for _, name := range formatNames {
+		fmt.Printf("Format:    %v\n\n", name)
+		opts.FormatName = name
+		code, err := CliDownload(ctx, &streamEp, opts)
+		if code != ItemSuccessful {
+			return code, err
+		}
+	}
+	err = core.WriteHlsMasterPlaylist(item.OutputFile, formatNames)
+	if err != nil {
+		CliErrorMessage(err)
+		return ItemFailed, err
+	}
+	return ItemSuccessful, nil
+}
+
+// The default output file, or the directory for --layout hls
+func cliOutputFilename(streamEp *core.StreamEpisode, chapter *core.StreamEpChapter) string {
+	if Arguments.Layout == core.LayoutHls {
+		return core.HlsMirrorDir(streamEp.ProposeFilename(chapter))
+	}
+	return core.ContainerFilename(streamEp.ProposeFilename(chapter), Arguments.Container)
+}
+
+// Download the selected chapters into separate files. The chunk list is
+// only fetched once and chunks at the chapter boundaries are reused.
+func CliDownloadChapters(ctx context.Context, streamEp *core.StreamEpisode, item *BatchItem, limiter *core.RateLimiter) (int, error) {
+	chapterNums := Arguments.Chapters
+	if len(chapterNums) == 0 {
+		for i := range streamEp.Chapters {
+			chapterNums = append(chapterNums, i+1)
+		}
+	}
+	if len(chapterNums) == 0 {
+		err := &GenericCliAgumentError{Msg: "this video has no chapters"}
+		CliErrorMessage(err)
+		return ItemFailed, err
+	}
+	format, _ := streamEp.FormatByName(item.FormatName)
+	chunklist, err := format.StreamChunkList(ctx, Arguments.RetryPolicy)
+	if ctx.Err() != nil {
+		fmt.Print("\nAborted.")
+		return ItemAborted, nil
+	} else if err != nil {
+		CliErrorMessage(err)
+		return ItemFailed, err
+	}
+	cache := core.NewChunkCache(Arguments.Connections + 2)
+	status := ItemSuccessful
+	var statusErr error
+	for _, n := range chapterNums {
+		chapter, err := streamEp.ChapterByNumber(n)
+		if err != nil {
+			CliErrorMessage(err)
+			status, statusErr = ItemFailed, err
+			continue
+		}
+		outputFile := cliOutputFilename(streamEp, chapter)
+		fmt.Printf("\nChapter:   %v. %v\n", n, chapter.Category.Title)
+		fmt.Printf("Output:    %v\n", outputFile)
+		fmt.Print("\n")
+		code, err := CliDownload(ctx, streamEp, core.DownloadOptions{
+			Chapter: chapter,
+			FormatName: format.Name,
+			OutputFile: outputFile,
+			Overwrite: Arguments.Overwrite,
+			ContinueDl: Arguments.ContinueDl,
+			StartOffset: -1,
+			StopOffset: -1,
+			RateLimiter: limiter,
+			RetryPolicy: Arguments.RetryPolicy,
+			Connections: Arguments.Connections,
+			NoPartFile: Arguments.NoPartFile,
+			PreciseCut: Arguments.PreciseCut,
+			NoValidation: Arguments.NoValidation,
+			Container: Arguments.Container,
+			Layout: Arguments.Layout,
+			ChunkList: &chunklist,
+			ChunkCache: cache,
+		})
+		if code == ItemAborted {
+			return code, err
+		} else if code != ItemSuccessful {
+			status, statusErr = code, err
+		}
+	}
+	return status, statusErr
+}
+
+func CliDownload(ctx context.Context, streamEp *core.StreamEpisode, opts core.DownloadOptions) (int, error) {
 	successful := false
 	aborted := false
-	for p := range streamEp.DownloadStreamEpisode(
-		targetChapter,
-		Arguments.FormatName,
-		Arguments.OutputFile,
-		Arguments.Overwrite,
-		Arguments.ContinueDl,
-		Arguments.StartDuration,
-		Arguments.StopDuration,
-		Arguments.Ratelimit,
-		make(chan os.Signal, 1),
-	) { // Iterate over download progress
+	invalidChunks := 0
+	impreciseStart := false
+	for p := range streamEp.DownloadStreamEpisode(ctx, opts) { // Iterate over download progress
 		if p.Error != nil {
 			CliErrorMessage(p.Error)
-			return 1
+			return ItemFailed, p.Error
 		}
 		if p.Success {
 			successful = true
 		} else if p.Aborted {
 			aborted = true
+		} else if p.Remuxing {
+			fmt.Print("\nRemuxing ...")
 		} else {
-			CliDownloadProgress(p.Progress, p.Rate, p.Delaying, p.Waiting, p.Retries, p.Title)
+			if p.ImpreciseStart && !impreciseStart {
+				fmt.Print("\nNo keyframe before the start, the video starts at the beginning of its chunk.\n")
+				impreciseStart = true
+			}
+			CliDownloadProgress(p, p.InvalidChunks > invalidChunks)
+			invalidChunks = p.InvalidChunks
 		}
 	}
 	fmt.Print("\n")
 	if aborted {
 		fmt.Print("\nAborted.                                                ")
-		return 130
+		return ItemAborted, nil
 	} else if !successful {
-		CliErrorMessage(&GenericDownloadError{})
-		return 1
-	} else { return 0 }
+		err := &GenericDownloadError{}
+		CliErrorMessage(err)
+		return ItemFailed, err
+	} else { return ItemSuccessful, nil }
 }
 
 func CliAvailableChapters(chapters []core.StreamEpChapter) {
@@ -241,32 +597,72 @@ func CliAvailableChapters(chapters []core.StreamEpChapter) {
 func CliAvailableFormats(formats []core.VideoFormat) {
 	fmt.Print("Formats:   ")
 	for i, f := range formats {
+		name := f.Name
+		if f.IsHevc() && !strings.Contains(strings.ToLower(name), "hevc") {
+			name += " (HEVC)"
+		}
 		if i == 0 {
-			fmt.Print(f.Name)
+			fmt.Print(name)
 		} else {
-			fmt.Print(", ", f.Name)
+			fmt.Print(", ", name)
 		}
 	}
 	fmt.Print("\n")
 }
 
-func CliDownloadProgress(progress float32, rate float64, delaying bool, waiting bool, retries int, title string) {
-	if retries > 0 {
-		if retries == 1 {
+func CliDownloadProgress(p core.DownloadProgress, invalid bool) {
+	line := cliProgressLine(&p)
+	if p.Retries > 0 {
+		if p.Retries == 1 {
 			fmt.Print("\n")
 		}
-		fmt.Printf("Downloaded %.2f%% @ %.2f MB/s (retry %v) ...      ", progress*100.0, rate/1000000.0, retries)
+		reason := ""
+		if invalid {
+			reason = ", invalid chunk"
+		}
+		fmt.Printf("%v (retry %v%v) ...      ", line, p.Retries, reason)
 		fmt.Print("\n")
-	} else if waiting {
-		fmt.Printf("Downloaded %.2f%% @ %.2f MB/s ...                 \r", progress*100.0, rate/1000000.0)
-	} else if delaying {
-		fmt.Printf("Downloaded %.2f%% @ %.2f MB/s (delaying) ...      \r", progress*100.0, rate/1000000.0)
+	} else if p.Waiting {
+		fmt.Printf("%v ...                 \r", line)
+	} else if p.Delaying {
+		fmt.Printf("%v (delaying) ...      \r", line)
 	} else {
-		fmt.Printf("Downloaded %.2f%% @ %.2f MB/s                     \r", progress*100.0, rate/1000000.0)
+		fmt.Printf("%v                     \r", line)
 	}
 	if CliXtermTitle {
-		XtermSetTitle(fmt.Sprintf("lurch-dl - Downloaded %.2f%% @ %.2f MB/s - %v", progress*100.0, rate/1000000.0, title))
+		XtermSetTitle(fmt.Sprintf("lurch-dl - Downloaded %.2f%% @ %.2f MB/s - %v", p.Progress*100.0, p.Rate/1000000.0, p.Title))
+	}
+}
+
+// e.g. 12.34% [34/120] 123.4/~456.7 MB @ 1.23 MB/s (avg 1.01) ETA 5m12s | 1:02:03 ch. 3
+func cliProgressLine(p *core.DownloadProgress) string {
+	var b strings.Builder
+	if p.Live {
+		fmt.Fprintf(&b, "LIVE [%v/%v] ", p.ChunksDone, p.ChunksTotal)
+	} else {
+		fmt.Fprintf(&b, "%.2f%% [%v/%v] ", p.Progress*100.0, p.ChunksDone, p.ChunksTotal)
+	}
+	if p.EstimatedSize > 0 {
+		fmt.Fprintf(&b, "%.1f/~%.1f MB", float64(p.BytesWritten)/1000000.0, float64(p.EstimatedSize)/1000000.0)
+	} else {
+		fmt.Fprintf(&b, "%.1f MB", float64(p.BytesWritten)/1000000.0)
+	}
+	fmt.Fprintf(&b, " @ %.2f MB/s (avg %.2f)", p.Rate/1000000.0, p.AverageRate/1000000.0)
+	if p.Eta >= 0 {
+		fmt.Fprintf(&b, " ETA %v", p.Eta.Round(time.Second))
+	}
+	position := p.Position.Round(time.Second)
+	fmt.Fprintf(&b, " | %d:%02d:%02d", int(position.Hours()), int(position.Minutes())%60, int(position.Seconds())%60)
+	if p.Chapter != nil {
+		fmt.Fprintf(&b, " ch. %v", p.Chapter.Index+1)
+	}
+	if p.MissedChunks > 0 {
+		fmt.Fprintf(&b, " (%v chunks missed)", p.MissedChunks)
+	}
+	if p.ReloadError != nil {
+		fmt.Fprintf(&b, " (reload failed: %v)", p.ReloadError)
 	}
+	return b.String()
 }
 
 func CliErrorMessage(err error) {
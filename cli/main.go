@@ -4,10 +4,13 @@ package main
 
 import (
 	"os"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core"
 )
 
 var Version = "dev"
 
 func main() {
+	core.ToolVersion = Version
 	os.Exit(CliRun())
 }
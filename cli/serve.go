@@ -0,0 +1,115 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core"
+)
+
+func CliShowServeHelp() {
+	fmt.Println(`
+lurch-dl serve              Start a local HLS server to watch episodes in a
+                            video player, e.g.
+                              mpv http://127.0.0.1:8080/777/1080p60.m3u8
+                            Playlists can be cut with ?chapter=<int>,
+                            ?start=<duration> and ?stop=<duration>.
+         [-h --help]        Show this help and exit
+         [--listen string]  The address to listen on
+                            default: 127.0.0.1:8080
+         [--cache-dir string]
+                            Where to cache the video chunks, use "" to
+                            disable the cache
+                            default: <user cache dir>/lurch-dl
+         [--max-rate float] The maximum download rate in MB/s
+                            default: 16.0
+         [--retries int]    How often a failed request is retried
+                            default: 5
+
+Version: ` + Version)
+}
+
+func CliServe(args []string) int {
+	var help bool
+	var listen, cacheDir string
+	var ratelimitMbs float64
+	var retries int
+	defaultCacheDir, err := os.UserCacheDir()
+	if err == nil {
+		defaultCacheDir = filepath.Join(defaultCacheDir, "lurch-dl")
+	}
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.Usage = CliShowServeHelp
+	flags.BoolVar(&help, "h", false, "")
+	flags.BoolVar(&help, "help", false, "")
+	flags.StringVar(&listen, "listen", "127.0.0.1:8080", "")
+	flags.StringVar(&cacheDir, "cache-dir", defaultCacheDir, "")
+	flags.Float64Var(&ratelimitMbs, "max-rate", 16.0, "")
+	flags.IntVar(&retries, "retries", core.MaxRetries, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if help {
+		CliShowServeHelp()
+		return 0
+	}
+	if ratelimitMbs <= 0 || retries < 0 {
+		CliShowServeHelp()
+		CliErrorMessage(&GenericCliAgumentError{Msg: "the value of --max-rate must be greater than 0 and --retries must not be negative"})
+		return 1
+	}
+	policy := core.DefaultRetryPolicy
+	policy.MaxAttempts = retries + 1
+	limiter := core.NewRateLimiter(ratelimitMbs*1_000_000.0, core.RatelimitBurst)
+	proxy := core.NewHlsProxy(limiter, policy, cacheDir)
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		CliErrorMessage(err)
+		return 1
+	}
+	server := &http.Server{Handler: cliLogRequests(proxy)}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	fmt.Printf("Serving on http://%v/ - open http://%v/<episode>/<format>.m3u8 in your video player\n", listener.Addr(), listener.Addr())
+	err = server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		CliErrorMessage(err)
+		return 1
+	}
+	return 0
+}
+
+type cliStatusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *cliStatusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func cliLogRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &cliStatusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		handler.ServeHTTP(recorder, r)
+		fmt.Printf("%v %v %v (%v)\n", r.Method, r.URL.RequestURI(), recorder.status, time.Since(start).Round(time.Millisecond))
+	})
+}
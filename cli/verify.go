@@ -0,0 +1,172 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core"
+)
+
+func CliShowVerifyHelp() {
+	fmt.Println(`
+lurch-dl verify file...     Check downloaded .ts files for damage: sync
+                            loss, gaps in the continuity counters, jumping
+                            timestamps and missing video
+         [-h --help]        Show this help and exit
+         [--url string]     The url to the video or the episode number, to
+                            compare the duration of the files with it
+         [--chapter int]    Compare the duration with this chapter instead
+         [--start string]   The file starts at this timestamp, e.g. 12m34s
+         [--stop string]    The file stops at this timestamp, e.g. 1h23m45s
+         [--json]           Print the reports as JSON
+
+Version: ` + Version)
+}
+
+type VerifyResult struct {
+	File   string         `json:"file"`
+	Ok     bool           `json:"ok"`
+	Error  string         `json:"error,omitempty"`
+	Report *core.TsReport `json:"report,omitempty"`
+}
+
+func CliVerify(args []string) int {
+	var help, jsonOutput bool
+	var url, start, stop string
+	var chapterNum int
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.Usage = CliShowVerifyHelp
+	flags.BoolVar(&help, "h", false, "")
+	flags.BoolVar(&help, "help", false, "")
+	flags.StringVar(&url, "url", "", "")
+	flags.IntVar(&chapterNum, "chapter", 0, "")
+	flags.StringVar(&start, "start", "", "")
+	flags.StringVar(&stop, "stop", "", "")
+	flags.BoolVar(&jsonOutput, "json", false, "")
+	// files and flags can be mixed
+	files := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return 1
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		files = append(files, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if help {
+		CliShowVerifyHelp()
+		return 0
+	}
+	if len(files) == 0 {
+		CliShowVerifyHelp()
+		return 1
+	}
+	expected, err := cliExpectedDuration(url, chapterNum, start, stop)
+	if err != nil {
+		CliErrorMessage(err)
+		return 1
+	}
+	exitCode := 0
+	results := []VerifyResult{}
+	for _, filename := range files {
+		result := VerifyResult{File: filename}
+		f, err := os.Open(filename)
+		if err == nil {
+			var report core.TsReport
+			report, err = core.VerifyTs(f, expected)
+			f.Close()
+			result.Report = &report
+			result.Ok = err == nil && report.Ok()
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		if !result.Ok {
+			exitCode = 1
+		}
+		if jsonOutput {
+			results = append(results, result)
+		} else {
+			cliPrintVerifyResult(&result)
+		}
+	}
+	if jsonOutput {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(data))
+	}
+	return exitCode
+}
+
+// The duration the files should have, 0 if it's unknown
+func cliExpectedDuration(url string, chapterNum int, start string, stop string) (time.Duration, error) {
+	from, to := time.Duration(0), time.Duration(0)
+	var err error
+	if url != "" {
+		ep, err := core.StreamEpisodeFromUrl(context.Background(), expandEpisodeUrl(url), core.DefaultRetryPolicy)
+		if err != nil {
+			return 0, err
+		}
+		to = ep.Meta.Duration
+		chapter, err := ep.ChapterByNumber(chapterNum)
+		if err != nil {
+			return 0, err
+		}
+		if chapter != nil {
+			from = chapter.StartOffset
+			if chapter.EndOffset > chapter.StartOffset {
+				to = chapter.EndOffset
+			}
+		}
+	}
+	if start != "" {
+		from, err = time.ParseDuration(start)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if stop != "" {
+		to, err = time.ParseDuration(stop)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return max(to-from, 0), nil
+}
+
+func cliPrintVerifyResult(result *VerifyResult) {
+	status := "OK"
+	if !result.Ok {
+		status = "DAMAGED"
+	}
+	fmt.Printf("\n%v: %v\n", result.File, status)
+	if result.Error != "" {
+		fmt.Printf("  Error:     %v\n", result.Error)
+	}
+	r := result.Report
+	if r == nil {
+		return
+	}
+	fmt.Printf("  Size:      %.2f MB (%v packets)\n", float64(r.Size)/1000000.0, r.Packets)
+	if r.ExpectedDuration > 0 {
+		fmt.Printf("  Duration:  %v (expected %v)\n", r.Duration.Round(time.Second), r.ExpectedDuration)
+	} else {
+		fmt.Printf("  Duration:  %v\n", r.Duration.Round(time.Second))
+	}
+	fmt.Printf("  Sync loss: %v, invalid packets: %v, continuity errors: %v, timestamp errors: %v\n",
+		r.SyncLosses, r.InvalidPackets, r.ContinuityErrors, r.TimestampErrors)
+	for _, issue := range r.Issues {
+		if issue.Pid != 0 {
+			fmt.Printf("  - %v at byte %v (PID %v): %v\n", issue.Kind, issue.Offset, issue.Pid, issue.Msg)
+		} else {
+			fmt.Printf("  - %v at byte %v: %v\n", issue.Kind, issue.Offset, issue.Msg)
+		}
+	}
+}
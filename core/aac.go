@@ -0,0 +1,65 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import "iter"
+
+const aacSamplesPerFrame = 1024
+
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+type adtsHeader struct {
+	objectType      int // MPEG-4 audio object type, 2 = AAC LC
+	sampleRateIndex int
+	channelConfig   int
+	headerLen       int
+	frameLen        int // including the header
+}
+
+func (h *adtsHeader) sampleRate() int {
+	return aacSampleRates[h.sampleRateIndex]
+}
+
+// AudioSpecificConfig (ISO/IEC 14496-3)
+func (h *adtsHeader) audioSpecificConfig() []byte {
+	return []byte{
+		byte(h.objectType<<3 | h.sampleRateIndex>>1),
+		byte(h.sampleRateIndex<<7 | h.channelConfig<<3),
+	}
+}
+
+func parseAdtsHeader(b []byte) (adtsHeader, error) {
+	h := adtsHeader{}
+	if len(b) < 7 || b[0] != 0xff || b[1]&0xf0 != 0xf0 {
+		return h, &TsParseError{Msg: "ADTS sync word missing"}
+	}
+	h.headerLen = 7
+	if b[1]&0x01 == 0 {
+		h.headerLen = 9 // with CRC
+	}
+	h.objectType = int(b[2]>>6) + 1
+	h.sampleRateIndex = int(b[2] >> 2 & 0x0f)
+	h.channelConfig = int(b[2]&0x01)<<2 | int(b[3]>>6)
+	h.frameLen = int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5]>>5)
+	if h.sampleRateIndex >= len(aacSampleRates) || h.frameLen < h.headerLen {
+		return h, &TsParseError{Msg: "invalid ADTS header"}
+	}
+	return h, nil
+}
+
+// Iterate over the ADTS frames in data, yielding the header and the raw
+// AAC frame. Stops at the first invalid or incomplete frame.
+func adtsFrames(data []byte) iter.Seq2[adtsHeader, []byte] {
+	return func(yield func(adtsHeader, []byte) bool) {
+		for len(data) > 0 {
+			h, err := parseAdtsHeader(data)
+			if err != nil || h.frameLen > len(data) {
+				return
+			}
+			if !yield(h, data[h.headerLen:h.frameLen]) {
+				return
+			}
+			data = data[h.frameLen:]
+		}
+	}
+}
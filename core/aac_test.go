@@ -0,0 +1,73 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseAdtsHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   adtsHeader
+		valid  bool
+	}{
+		{"48 kHz stereo", []byte{0xff, 0xf1, 0x4c, 0x80, 0x03, 0x7f, 0xfc}, adtsHeader{2, 3, 2, 7, 27}, true},
+		{"44.1 kHz mono, crc", []byte{0xff, 0xf0, 0x50, 0x40, 0x20, 0x1f, 0xfc, 0x00, 0x00}, adtsHeader{2, 4, 1, 9, 256}, true},
+		{"no sync word", []byte{0xff, 0x01, 0x4c, 0x80, 0x03, 0x7f, 0xfc}, adtsHeader{}, false},
+		{"too short", []byte{0xff, 0xf1, 0x4c}, adtsHeader{}, false},
+		{"sample rate index", []byte{0xff, 0xf1, 0x7c, 0x80, 0x03, 0x7f, 0xfc}, adtsHeader{}, false},
+		{"frame shorter than header", []byte{0xff, 0xf1, 0x4c, 0x80, 0x00, 0xbf, 0xfc}, adtsHeader{}, false},
+	}
+	for _, tt := range tests {
+		h, err := parseAdtsHeader(tt.header)
+		if (err == nil) != tt.valid {
+			t.Errorf("%v: %v", tt.name, err)
+		} else if tt.valid && h != tt.want {
+			t.Errorf("%v: %+v instead of %+v", tt.name, h, tt.want)
+		}
+	}
+	h := adtsHeader{objectType: 2, sampleRateIndex: 3, channelConfig: 2}
+	if config := h.audioSpecificConfig(); !bytes.Equal(config, []byte{0x11, 0x90}) || h.sampleRate() != 48000 {
+		t.Errorf("AudioSpecificConfig % x, %v Hz", config, h.sampleRate())
+	}
+}
+
+func TestAdtsFrames(t *testing.T) {
+	frame := []byte{0xff, 0xf1, 0x4c, 0x80, 0x01, 0x3f, 0xfc, 1, 2}
+	data := append(bytes.Repeat(frame, 3), frame[:8]...) // the last frame is incomplete
+	n := 0
+	for h, payload := range adtsFrames(data) {
+		if h.frameLen != 9 || !bytes.Equal(payload, []byte{1, 2}) {
+			t.Errorf("frame %v: %+v, % x", n, h, payload)
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("%v frames instead of 3", n)
+	}
+}
+
+func TestTsToAdts(t *testing.T) {
+	data, err := tsToAdts(newTestTsWriter(tsStreamTypeH264).chunk(0, 60, testKeyframes(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	size := 0
+	for h, payload := range adtsFrames(data) {
+		if h.sampleRate() != 48000 || !bytes.Equal(payload, bytes.Repeat([]byte{0x21}, 20)) {
+			t.Errorf("frame %v: %+v", n, h)
+		}
+		size += h.frameLen
+		n++
+	}
+	if n != 94 || size != len(data) {
+		t.Errorf("%v frames in %v of %v bytes", n, size, len(data))
+	}
+	if _, err := tsToAdts(nil); err == nil {
+		t.Error("no error without audio")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core/m3u8"
+)
+
+// Only AES-128 with raw keys is supported (RFC 8216, 5.2)
+func checkChunkKey(key *m3u8.Key) error {
+	if key == nil {
+		return nil
+	}
+	if key.Method != m3u8.KeyMethodAes128 || (key.KeyFormat != "" && key.KeyFormat != "identity") {
+		return &EncryptionUnsupportedError{Method: key.Method, KeyFormat: key.KeyFormat}
+	}
+	return nil
+}
+
+// The keys of encrypted chunks, every key is only fetched once, also
+// by concurrent downloads
+type chunkKeys struct {
+	mutex sync.Mutex
+	keys  map[string]*chunkKey
+}
+
+type chunkKey struct {
+	done chan struct{} // closed when the key is fetched
+	key  []byte
+	err  error
+	// the context of the caller that fetched the key was done
+	cancelled bool
+}
+
+func newChunkKeys() *chunkKeys {
+	return &chunkKeys{keys: map[string]*chunkKey{}}
+}
+
+func (k *chunkKeys) get(ctx context.Context, url string) ([]byte, error) {
+	k.mutex.Lock()
+	entry, ok := k.keys[url]
+	if !ok {
+		entry = &chunkKey{done: make(chan struct{})}
+		k.keys[url] = entry
+	}
+	k.mutex.Unlock()
+	if ok {
+		select {
+		case <-entry.done:
+			if entry.cancelled {
+				// the error only applies to the other caller
+				return k.get(ctx, url)
+			}
+			return entry.key, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	entry.key, entry.err = httpGet(ctx, url, ApiHeadersVideoAdditional, time.Second*5, nil)
+	entry.cancelled = ctx.Err() != nil
+	if entry.err == nil && len(entry.key) != aes.BlockSize {
+		entry.err = &EncryptionKeyError{Url: url, Size: len(entry.key)}
+	}
+	if entry.err != nil {
+		// fetched again by the next attempt
+		k.mutex.Lock()
+		delete(k.keys, url)
+		k.mutex.Unlock()
+	}
+	close(entry.done)
+	return entry.key, entry.err
+}
+
+// Decrypt the downloaded data of a chunk, if it is encrypted. Without
+// an explicit IV, the media sequence number is the IV.
+func (k *chunkKeys) decrypt(ctx context.Context, chunk *Chunk, data []byte) ([]byte, error) {
+	if chunk.Key == nil {
+		return data, nil
+	}
+	if err := checkChunkKey(chunk.Key); err != nil {
+		return nil, err
+	}
+	key, err := k.get(ctx, chunk.Key.Uri)
+	if err != nil {
+		return nil, err
+	}
+	iv := chunk.Key.Iv
+	if iv == nil {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], uint64(chunk.SequenceNumber))
+	}
+	return decryptAes128Cbc(chunk.Url, key, iv, data)
+}
+
+// AES-128-CBC with PKCS7 padding
+func decryptAes128Cbc(url string, key []byte, iv []byte, data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, &ChunkValidationError{Url: url, Msg: fmt.Sprintf("the encrypted size (%v bytes) is not a multiple of %v bytes", len(data), aes.BlockSize)}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, &ChunkValidationError{Url: url, Msg: "invalid padding after decryption, wrong key or IV?"}
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, &ChunkValidationError{Url: url, Msg: "invalid padding after decryption, wrong key or IV?"}
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
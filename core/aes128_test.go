@@ -0,0 +1,235 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+const testIv = "00112233445566778899aabbccddeeff"
+
+func encryptAes128Cbc(t *testing.T, key []byte, iv []byte, plain []byte) []byte {
+	t.Helper()
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	data := append(bytes.Clone(plain), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return data
+}
+
+func sequenceIv(n int64) []byte {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(n))
+	return iv
+}
+
+// Serves a playlist starting at media sequence 7: two chunks with the
+// sequence number as IV, one with an explicit IV and an unencrypted one
+func newEncryptedServer(t *testing.T, method string, key []byte) (*httptest.Server, [][]byte, *atomic.Int32) {
+	t.Helper()
+	plain := [][]byte{}
+	for i := range 4 {
+		// not a multiple of the block size
+		plain = append(plain, bytes.Repeat([]byte{byte(i + 1)}, 1000+i))
+	}
+	explicitIv, _ := hex.DecodeString(testIv)
+	chunks := [][]byte{
+		encryptAes128Cbc(t, testKey, sequenceIv(7), plain[0]),
+		encryptAes128Cbc(t, testKey, sequenceIv(8), plain[1]),
+		encryptAes128Cbc(t, testKey, explicitIv, plain[2]),
+		plain[3],
+	}
+	keyRequests := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.m3u8":
+			var b strings.Builder
+			b.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:7\n")
+			fmt.Fprintf(&b, "#EXT-X-KEY:METHOD=%v,URI=\"/key.bin\"\n", method)
+			b.WriteString("#EXTINF:2,\nc0.ts\n#EXTINF:2,\nc1.ts\n")
+			fmt.Fprintf(&b, "#EXT-X-KEY:METHOD=%v,URI=\"/key.bin\",IV=0x%v\n", method, testIv)
+			b.WriteString("#EXTINF:2,\nc2.ts\n")
+			b.WriteString("#EXT-X-KEY:METHOD=NONE\n#EXTINF:2,\nc3.ts\n#EXT-X-ENDLIST\n")
+			w.Write([]byte(b.String()))
+		case "/key.bin":
+			keyRequests.Add(1)
+			w.Write(key)
+		default:
+			var i int
+			if _, err := fmt.Sscanf(r.URL.Path, "/c%d.ts", &i); err != nil || i >= len(chunks) {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(chunks[i])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, plain, keyRequests
+}
+
+func downloadTestEpisode(t *testing.T, playlistUrl string, connections int) (string, error) {
+	t.Helper()
+	ep := StreamEpisode{Title: "test", Formats: []VideoFormat{{Name: "720p", Url: playlistUrl}}}
+	output := filepath.Join(t.TempDir(), "test.ts")
+	opts := DownloadOptions{
+		FormatName:   "720p",
+		OutputFile:   output,
+		StartOffset:  -1,
+		StopOffset:   -1,
+		Connections:  connections,
+		NoValidation: true, // the chunks are no transport streams
+		RetryPolicy:  RetryPolicy{MaxAttempts: 1},
+	}
+	for p := range ep.DownloadStreamEpisode(context.Background(), opts) {
+		if p.Error != nil {
+			return output, p.Error
+		}
+	}
+	return output, nil
+}
+
+func TestDownloadAes128(t *testing.T) {
+	for _, connections := range []int{1, 3} {
+		t.Run(fmt.Sprintf("connections=%v", connections), func(t *testing.T) {
+			srv, plain, keyRequests := newEncryptedServer(t, "AES-128", testKey)
+			output, err := downloadTestEpisode(t, srv.URL+"/index.m3u8", connections)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, bytes.Join(plain, nil)) {
+				t.Errorf("the output (%v bytes) is not the decrypted video (%v bytes)", len(data), len(bytes.Join(plain, nil)))
+			}
+			if n := keyRequests.Load(); n != 1 {
+				t.Errorf("the key was fetched %v times instead of once", n)
+			}
+		})
+	}
+}
+
+func TestDownloadAes128WrongKey(t *testing.T) {
+	srv, _, _ := newEncryptedServer(t, "AES-128", []byte("fedcba9876543210"))
+	_, err := downloadTestEpisode(t, srv.URL+"/index.m3u8", 1)
+	var validationErr *ChunkValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ChunkValidationError, got %v", err)
+	}
+}
+
+func TestDownloadAes128KeySize(t *testing.T) {
+	srv, _, _ := newEncryptedServer(t, "AES-128", []byte("short"))
+	_, err := downloadTestEpisode(t, srv.URL+"/index.m3u8", 1)
+	var keyErr *EncryptionKeyError
+	if !errors.As(err, &keyErr) || keyErr.Size != 5 {
+		t.Fatalf("expected an EncryptionKeyError for 5 bytes, got %v", err)
+	}
+}
+
+func TestDownloadSampleAes(t *testing.T) {
+	srv, _, keyRequests := newEncryptedServer(t, "SAMPLE-AES", testKey)
+	_, err := downloadTestEpisode(t, srv.URL+"/index.m3u8", 1)
+	var unsupportedErr *EncryptionUnsupportedError
+	if !errors.As(err, &unsupportedErr) || unsupportedErr.Method != "SAMPLE-AES" {
+		t.Fatalf("expected an EncryptionUnsupportedError, got %v", err)
+	}
+	if n := keyRequests.Load(); n != 0 {
+		t.Errorf("the key was fetched %v times", n)
+	}
+}
+
+func TestChunkKeysCancelled(t *testing.T) {
+	requests := &atomic.Int32{}
+	firstRequest := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// until the first caller gives up
+			close(firstRequest)
+			<-r.Context().Done()
+			return
+		}
+		w.Write(testKey)
+	}))
+	defer srv.Close()
+	keys := newChunkKeys()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelledErr := make(chan error)
+	go func() {
+		_, err := keys.get(ctx, srv.URL+"/key")
+		cancelledErr <- err
+	}()
+	<-firstRequest
+	// waits for the first caller
+	key := make(chan []byte)
+	go func() {
+		k, err := keys.get(context.Background(), srv.URL+"/key")
+		if err != nil {
+			t.Error(err)
+		}
+		key <- k
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-cancelledErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if k := <-key; !bytes.Equal(k, testKey) {
+		t.Errorf("the waiting caller got the key %q", k)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("the key was fetched %v times instead of twice", n)
+	}
+}
+
+func TestDecryptAes128Cbc(t *testing.T) {
+	iv := sequenceIv(1)
+	encrypted := encryptAes128Cbc(t, testKey, iv, []byte("sixteen bytes!!!"))
+	tests := []struct {
+		name string
+		key  []byte
+		data []byte
+		ok   bool
+	}{
+		{"valid", testKey, encrypted, true},
+		{"wrong key", []byte("fedcba9876543210"), encrypted, false},
+		{"truncated", testKey, encrypted[:len(encrypted)-1], false},
+		{"empty", testKey, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, err := decryptAes128Cbc("c0.ts", tt.key, iv, tt.data)
+			if tt.ok {
+				if err != nil || string(plain) != "sixteen bytes!!!" {
+					t.Errorf("got %q, %v", plain, err)
+				}
+				return
+			}
+			var validationErr *ChunkValidationError
+			if !errors.As(err, &validationErr) {
+				t.Errorf("expected a ChunkValidationError, got %v", err)
+			}
+		})
+	}
+}
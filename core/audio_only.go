@@ -0,0 +1,60 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import "fmt"
+
+// Extract the ADTS stream of the first AAC track of a TS chunk
+func tsToAdts(data []byte) ([]byte, error) {
+	out := []byte{}
+	pid := -1
+	demuxer := newTsDemuxer(func(u *pesUnit) {
+		if u.streamType != tsStreamTypeAac || !u.complete {
+			return
+		}
+		if pid < 0 {
+			pid = int(u.pid)
+		}
+		if int(u.pid) == pid {
+			out = append(out, u.data...)
+		}
+	})
+	for i := 0; i+tsPacketSize <= len(data); i += tsPacketSize {
+		demuxer.push(data[i : i+tsPacketSize])
+	}
+	demuxer.flush()
+	if pid < 0 {
+		return nil, &TsParseError{Msg: "no AAC audio found"}
+	}
+	return out, nil
+}
+
+// The chapters of the episode within the downloaded part, relative to
+// its start
+func downloadChapters(ep *StreamEpisode, chunklist *ChunkList, opts *DownloadOptions) []mp4Chapter {
+	if len(chunklist.Chunks) == 0 {
+		return nil
+	}
+	start := chunklist.Chunks[0].Start
+	if opts.PreciseCut && opts.StartOffset > start {
+		start = opts.StartOffset
+	}
+	last := chunklist.Chunks[len(chunklist.Chunks)-1]
+	end := last.Start + last.Duration
+	if opts.PreciseCut && opts.StopOffset > 0 {
+		end = min(end, opts.StopOffset)
+	}
+	chapters := []mp4Chapter{}
+	for _, c := range ep.Chapters {
+		if c.StartOffset >= end {
+			break
+		}
+		chapter := mp4Chapter{start: max(c.StartOffset-start, 0), title: fmt.Sprintf("%v. %v", c.Index+1, c.Category.Title)}
+		if len(chapters) > 0 && chapter.start == 0 {
+			// only the last chapter that started before the download
+			chapters = chapters[:0]
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import "sync"
+
+// Keeps the most recently downloaded chunks in memory, so consecutive
+// downloads (e.g. of adjacent chapters) don't have to download the
+// chunks at their boundaries twice.
+type ChunkCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	entries    map[string][]byte
+	order      []string
+}
+
+func NewChunkCache(maxEntries int) *ChunkCache {
+	return &ChunkCache{maxEntries: maxEntries, entries: map[string][]byte{}}
+}
+
+func (c *ChunkCache) Get(url string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, ok := c.entries[url]
+	return data, ok
+}
+
+func (c *ChunkCache) Put(url string, data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[url]; ok {
+		return
+	}
+	c.entries[url] = data
+	c.order = append(c.order, url)
+	// drop the oldest entries
+	for len(c.order) > c.maxEntries {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ContainerTs  = "ts"  // the transport stream as it is served
+	ContainerMkv = "mkv" // Matroska
+	ContainerMp4 = "mp4" // fragmented MP4
+	ContainerAac = "aac" // only the audio, ADTS
+	ContainerM4a = "m4a" // only the audio, fragmented MP4
+)
+
+var Containers = []string{ContainerTs, ContainerMkv, ContainerMp4, ContainerAac, ContainerM4a}
+
+// Containers that only contain the audio
+var AudioContainers = []string{ContainerAac, ContainerM4a}
+
+// Replace the .ts extension of a filename
+func ContainerFilename(filename string, container string) string {
+	return strings.TrimSuffix(filename, ".ts") + "." + container
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// Remux the transport stream in input into <outputFile>.part, which is
+// renamed to outputFile on success
+func remuxFile(ctx context.Context, input *os.File, outputFile string, container string) error {
+	_, err := input.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	partFilename := outputFile + ".part"
+	output, err := os.OpenFile(partFilename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	r := ctxReader{ctx: ctx, r: bufio.NewReaderSize(input, 1<<20)}
+	switch container {
+	case ContainerMkv:
+		err = RemuxTsToMkv(r, output)
+	default:
+		err = &ContainerUnsupportedError{Container: container}
+	}
+	if err == nil {
+		err = output.Sync()
+	}
+	output.Close()
+	if err != nil {
+		os.Remove(partFilename)
+		return err
+	}
+	err = os.Rename(partFilename, outputFile)
+	if err == nil {
+		err = syncDir(filepath.Dir(outputFile))
+	}
+	return err
+}
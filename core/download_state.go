@@ -0,0 +1,184 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const DownloadStateVersion = 1
+
+// Will be written into the download state file; set by the application
+var ToolVersion = "dev"
+
+type ChunkState struct {
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// The content of the .dl-info file next to an unfinished download
+type DownloadState struct {
+	StateVersion int    `json:"state_version"`
+	ToolVersion  string `json:"tool_version"`
+	EpisodeId    string `json:"episode_id"`
+	FormatName   string `json:"format_name"`
+	PlaylistUrl  string `json:"playlist_url"`
+	// The range of the downloaded chunks in the uncut chunk list
+	FirstChunk int `json:"first_chunk"`
+	LastChunk  int `json:"last_chunk"`
+	ChunkCount int `json:"chunk_count"`
+	PreciseCut bool `json:"precise_cut"`
+	Container  string `json:"container,omitempty"` // empty for ContainerTs
+	// Committed chunks
+	NextChunk     int          `json:"next_chunk"`
+	CommittedSize int64        `json:"committed_size"`
+	Chunks        []ChunkState `json:"chunks"`
+	// Only for ContainerMp4 and ContainerM4a
+	Mp4 *Mp4State `json:"mp4,omitempty"`
+	// Set if the state was migrated from the old .dl-info format, which
+	// doesn't know about the chunks committed before the migration
+	Migrated bool `json:"migrated,omitempty"`
+}
+
+func newDownloadState(ep *StreamEpisode, format *VideoFormat, chunklist *ChunkList, opts *DownloadOptions) DownloadState {
+	state := DownloadState{
+		StateVersion: DownloadStateVersion,
+		ToolVersion:  ToolVersion,
+		EpisodeId:    ep.Id,
+		FormatName:   format.Name,
+		PlaylistUrl:  format.Url,
+		FirstChunk:   chunklist.FirstChunk,
+		LastChunk:    chunklist.FirstChunk + len(chunklist.Chunks),
+		ChunkCount:   len(chunklist.Chunks),
+		PreciseCut:   opts.PreciseCut,
+		Chunks:       []ChunkState{},
+	}
+	if opts.Container != ContainerTs {
+		state.Container = opts.Container
+	}
+	switch opts.Container {
+	case ContainerMp4:
+		state.Mp4 = &Mp4State{}
+	case ContainerM4a:
+		state.Mp4 = &Mp4State{AudioOnly: true}
+	}
+	return state
+}
+
+func (s *DownloadState) commitChunk(size int64) {
+	s.Chunks = append(s.Chunks, ChunkState{Offset: s.CommittedSize, Size: size})
+	s.CommittedSize += size
+	s.NextChunk++
+}
+
+// Check if the loaded state belongs to the same download as expected
+func (s *DownloadState) validate(expected *DownloadState) error {
+	if s.StateVersion > DownloadStateVersion {
+		return &DownloadStateVersionError{Version: s.StateVersion}
+	}
+	if s.StateVersion == 0 {
+		// the old format doesn't contain any information to compare,
+		// but it was only used for transport streams, which are also
+		// the input of the Matroska remuxer
+		if expected.Container != "" && expected.Container != ContainerMkv {
+			return &DownloadStateMismatchError{Field: "container", Expected: expected.Container, Found: ContainerTs}
+		}
+		nextChunk := s.NextChunk
+		*s = *expected
+		s.NextChunk = nextChunk
+		s.Migrated = true
+		if s.NextChunk > s.ChunkCount {
+			return &DownloadInfoFileReadError{}
+		}
+		return nil
+	}
+	mismatch := func(field string, expected any, found any) error {
+		return &DownloadStateMismatchError{Field: field, Expected: fmt.Sprint(expected), Found: fmt.Sprint(found)}
+	}
+	switch {
+	case s.EpisodeId != expected.EpisodeId:
+		return mismatch("episode", expected.EpisodeId, s.EpisodeId)
+	case s.FormatName != expected.FormatName:
+		return mismatch("format", expected.FormatName, s.FormatName)
+	case s.PlaylistUrl != expected.PlaylistUrl:
+		return mismatch("playlist url", expected.PlaylistUrl, s.PlaylistUrl)
+	case s.FirstChunk != expected.FirstChunk || s.LastChunk != expected.LastChunk:
+		return mismatch(
+			"chunk range",
+			fmt.Sprintf("%v-%v", expected.FirstChunk, expected.LastChunk),
+			fmt.Sprintf("%v-%v", s.FirstChunk, s.LastChunk))
+	case s.ChunkCount != expected.ChunkCount:
+		return mismatch("chunk count", expected.ChunkCount, s.ChunkCount)
+	case s.PreciseCut != expected.PreciseCut:
+		return mismatch("precise cut setting", expected.PreciseCut, s.PreciseCut)
+	case s.Container != expected.Container:
+		return mismatch("container", cmp.Or(expected.Container, ContainerTs), cmp.Or(s.Container, ContainerTs))
+	case expected.Mp4 != nil && s.Mp4 == nil:
+		return &DownloadInfoFileReadError{}
+	case s.NextChunk > s.ChunkCount || (!s.Migrated && s.NextChunk != len(s.Chunks)):
+		return &DownloadInfoFileReadError{}
+	}
+	return nil
+}
+
+func readDownloadState(filename string) (DownloadState, error) {
+	state := DownloadState{}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return state, &DownloadInfoFileReadError{}
+	}
+	// migrate the old format, which only contains the next chunk index
+	// (StateVersion 0), see validate()
+	if i, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32); err == nil {
+		state.NextChunk = int(i)
+		return state, nil
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, &DownloadInfoFileReadError{}
+	}
+	return state, nil
+}
+
+// Atomically replace the state file. The output file must be synced
+// before, so the state never points to data that isn't on disk yet.
+func writeDownloadState(filename string, state *DownloadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmpFilename := filename + ".tmp"
+	tmpFile, err := os.OpenFile(tmpFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(filename))
+}
+
+func syncDir(dirname string) error {
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
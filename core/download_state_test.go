@@ -0,0 +1,263 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testChunkCount = 6
+
+func testChunkData(i int) []byte {
+	return bytes.Repeat([]byte{byte(i + 1)}, 100+i)
+}
+
+func testEpisodeData(chunks int) []byte {
+	var data []byte
+	for i := range chunks {
+		data = append(data, testChunkData(i)...)
+	}
+	return data
+}
+
+// Serves a VOD playlist of testChunkCount chunks, the chunk with the
+// index in failing (-1 for none) isn't found
+func newVodServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	failing := &atomic.Int32{}
+	failing.Store(-1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/720p.m3u8" {
+			var b strings.Builder
+			b.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+			for i := range testChunkCount {
+				fmt.Fprintf(&b, "#EXTINF:2,\nc%v.ts\n", i)
+			}
+			b.WriteString("#EXT-X-ENDLIST\n")
+			w.Write([]byte(b.String()))
+			return
+		}
+		var i int
+		if _, err := fmt.Sscanf(r.URL.Path, "/c%d.ts", &i); err != nil || i >= testChunkCount || int32(i) == failing.Load() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(testChunkData(i))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, failing
+}
+
+func testVodDownload(srv *httptest.Server, output string, continueDl bool) error {
+	ep := StreamEpisode{Id: "777", Title: "test", Formats: []VideoFormat{{Name: "720p", Url: srv.URL + "/720p.m3u8"}}}
+	opts := DownloadOptions{
+		FormatName:   "720p",
+		OutputFile:   output,
+		ContinueDl:   continueDl,
+		StartOffset:  -1,
+		StopOffset:   -1,
+		NoValidation: true, // the chunks are no transport streams
+		RetryPolicy:  RetryPolicy{MaxAttempts: 1},
+	}
+	for p := range ep.DownloadStreamEpisode(context.Background(), opts) {
+		if p.Error != nil {
+			return p.Error
+		}
+	}
+	return nil
+}
+
+func TestDownloadStateValidate(t *testing.T) {
+	expected := DownloadState{
+		StateVersion: DownloadStateVersion,
+		EpisodeId:    "777",
+		FormatName:   "720p",
+		PlaylistUrl:  "https://example.com/720p.m3u8",
+		FirstChunk:   10,
+		LastChunk:    20,
+		ChunkCount:   10,
+		Chunks:       []ChunkState{},
+	}
+	tests := []struct {
+		name   string
+		modify func(s *DownloadState)
+		field  string // of the DownloadStateMismatchError, "" if valid
+	}{
+		{"valid", func(s *DownloadState) {}, ""},
+		{"committed chunks", func(s *DownloadState) { s.commitChunk(100); s.commitChunk(50) }, ""},
+		{"episode", func(s *DownloadState) { s.EpisodeId = "778" }, "episode"},
+		{"format", func(s *DownloadState) { s.FormatName = "1080p60" }, "format"},
+		{"playlist url", func(s *DownloadState) { s.PlaylistUrl += "?token=1" }, "playlist url"},
+		{"first chunk", func(s *DownloadState) { s.FirstChunk = 9 }, "chunk range"},
+		{"last chunk", func(s *DownloadState) { s.LastChunk = 21 }, "chunk range"},
+		{"chunk count", func(s *DownloadState) { s.ChunkCount = 11 }, "chunk count"},
+		{"precise cut", func(s *DownloadState) { s.PreciseCut = true }, "precise cut setting"},
+		{"container", func(s *DownloadState) { s.Container = ContainerMkv }, "container"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := expected
+			s.Chunks = []ChunkState{}
+			tt.modify(&s)
+			err := s.validate(&expected)
+			if tt.field == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			var mismatchErr *DownloadStateMismatchError
+			if !errors.As(err, &mismatchErr) || mismatchErr.Field != tt.field {
+				t.Errorf("expected a DownloadStateMismatchError for %v, got %v", tt.field, err)
+			}
+		})
+	}
+	// inconsistent states
+	for name, modify := range map[string]func(s *DownloadState){
+		"version":          func(s *DownloadState) { s.StateVersion = DownloadStateVersion + 1 },
+		"next chunk":       func(s *DownloadState) { s.NextChunk = 1 },
+		"after last chunk": func(s *DownloadState) { s.NextChunk = 11 },
+		"mp4 state":        func(s *DownloadState) { s.Container = ContainerMp4 },
+	} {
+		s := expected
+		modify(&s)
+		e := expected
+		if s.Container == ContainerMp4 {
+			e.Container, e.Mp4 = ContainerMp4, &Mp4State{}
+		}
+		if err := s.validate(&e); err == nil {
+			t.Errorf("%v: the state is valid", name)
+		}
+	}
+}
+
+func TestDownloadStateMismatch(t *testing.T) {
+	srv, failing := newVodServer(t)
+	output := filepath.Join(t.TempDir(), "test.ts")
+	failing.Store(3)
+	if err := testVodDownload(srv, output, false); err == nil {
+		t.Fatal("the download didn't fail")
+	}
+	// another episode into the same output
+	ep := StreamEpisode{Id: "778", Title: "test", Formats: []VideoFormat{{Name: "720p", Url: srv.URL + "/720p.m3u8"}}}
+	opts := DownloadOptions{FormatName: "720p", OutputFile: output, ContinueDl: true, StartOffset: -1, StopOffset: -1}
+	for p := range ep.DownloadStreamEpisode(context.Background(), opts) {
+		var mismatchErr *DownloadStateMismatchError
+		if !errors.As(p.Error, &mismatchErr) || mismatchErr.Field != "episode" || mismatchErr.Found != "777" {
+			t.Fatalf("expected a DownloadStateMismatchError for the episode, got %+v", p)
+		}
+		break
+	}
+	// the unfinished download is untouched
+	data, err := os.ReadFile(output + ".part")
+	if err != nil || !bytes.Equal(data, testEpisodeData(3)) {
+		t.Errorf("the .part file was modified (%v bytes, %v)", len(data), err)
+	}
+}
+
+func TestDownloadStateMigration(t *testing.T) {
+	srv, _ := newVodServer(t)
+	dir := t.TempDir()
+	output := filepath.Join(dir, "test.ts")
+	// the old format: the output file without .part and the next chunk
+	if err := os.WriteFile(output, testEpisodeData(2), 0660); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output+".dl-info", []byte("2"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	state, err := readDownloadState(output + ".dl-info")
+	if err != nil || state.StateVersion != 0 || state.NextChunk != 2 {
+		t.Fatalf("the old format wasn't read: %+v, %v", state, err)
+	}
+	if err := testVodDownload(srv, output, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil || !bytes.Equal(data, testEpisodeData(testChunkCount)) {
+		t.Errorf("the output (%v bytes, %v) is not the complete episode", len(data), err)
+	}
+	if _, err := os.Stat(output + ".dl-info"); !os.IsNotExist(err) {
+		t.Errorf("the state file wasn't removed: %v", err)
+	}
+}
+
+func TestDownloadStateMigrationMismatch(t *testing.T) {
+	expected := DownloadState{StateVersion: DownloadStateVersion, ChunkCount: 10, Chunks: []ChunkState{}}
+	tests := []struct {
+		container string
+		nextChunk int
+		valid     bool
+	}{
+		{"", 4, true},
+		{ContainerMkv, 4, true}, // remuxed from a transport stream
+		{ContainerMp4, 4, false},
+		{"", 11, false},
+	}
+	for _, tt := range tests {
+		e := expected
+		e.Container = tt.container
+		s := DownloadState{NextChunk: tt.nextChunk}
+		err := s.validate(&e)
+		if (err == nil) != tt.valid {
+			t.Errorf("container %q, next chunk %v: %v", tt.container, tt.nextChunk, err)
+		} else if tt.valid && (!s.Migrated || s.NextChunk != tt.nextChunk || s.ChunkCount != 10) {
+			t.Errorf("container %q: not migrated: %+v", tt.container, s)
+		}
+	}
+}
+
+func TestDownloadResumeAfterGarbage(t *testing.T) {
+	srv, failing := newVodServer(t)
+	output := filepath.Join(t.TempDir(), "test.ts")
+	failing.Store(3)
+	if err := testVodDownload(srv, output, false); err == nil {
+		t.Fatal("the download didn't fail")
+	}
+	state, err := readDownloadState(output + ".dl-info")
+	if err != nil || state.NextChunk != 3 || state.CommittedSize != int64(len(testEpisodeData(3))) || len(state.Chunks) != 3 {
+		t.Fatalf("unexpected state %+v, %v", state, err)
+	}
+	// e.g. a chunk that was written before the process got killed
+	f, err := os.OpenFile(output+".part", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(bytes.Repeat([]byte{0xff}, 77))
+	f.Close()
+	failing.Store(-1)
+	if err := testVodDownload(srv, output, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil || !bytes.Equal(data, testEpisodeData(testChunkCount)) {
+		t.Errorf("the output (%v bytes, %v) is not the complete episode", len(data), err)
+	}
+}
+
+func TestDownloadResumeTruncatedOutput(t *testing.T) {
+	srv, failing := newVodServer(t)
+	output := filepath.Join(t.TempDir(), "test.ts")
+	failing.Store(3)
+	testVodDownload(srv, output, false)
+	// committed data is missing
+	if err := os.Truncate(output+".part", 50); err != nil {
+		t.Fatal(err)
+	}
+	failing.Store(-1)
+	err := testVodDownload(srv, output, true)
+	var truncatedErr *OutputFileTruncatedError
+	if !errors.As(err, &truncatedErr) || truncatedErr.Size != 50 {
+		t.Fatalf("expected an OutputFileTruncatedError, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Helpers to write EBML elements (RFC 8794), as used by Matroska
+
+// Element IDs already contain their length marker
+func ebmlId(id uint32) []byte {
+	switch {
+	case id > 0xffffff:
+		return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xffff:
+		return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xff:
+		return []byte{byte(id >> 8), byte(id)}
+	default:
+		return []byte{byte(id)}
+	}
+}
+
+// Encode a data size with the minimal length
+func ebmlSize(size uint64) []byte {
+	length := 1
+	for length < 8 && size >= (1<<(7*length))-1 {
+		length++
+	}
+	return ebmlSizeFixed(size, length)
+}
+
+// Encode a data size with a fixed length, so it can be overwritten later
+func ebmlSizeFixed(size uint64, length int) []byte {
+	b := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		b[i] = byte(size)
+		size >>= 8
+	}
+	b[0] |= 0x80 >> (length - 1)
+	return b
+}
+
+func ebmlElement(id uint32, children ...[]byte) []byte {
+	size := 0
+	for _, c := range children {
+		size += len(c)
+	}
+	b := append(ebmlId(id), ebmlSize(uint64(size))...)
+	for _, c := range children {
+		b = append(b, c...)
+	}
+	return b
+}
+
+func ebmlUint(id uint32, value uint64) []byte {
+	data := []byte{}
+	for value > 0 || len(data) == 0 {
+		data = append([]byte{byte(value)}, data...)
+		value >>= 8
+	}
+	return ebmlElement(id, data)
+}
+
+// Always 8 bytes, so the value can be overwritten later
+func ebmlUintFixed(id uint32, value uint64) []byte {
+	return ebmlElement(id, binary.BigEndian.AppendUint64(nil, value))
+}
+
+func ebmlFloat(id uint32, value float64) []byte {
+	return ebmlElement(id, binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+}
+
+func ebmlString(id uint32, value string) []byte {
+	return ebmlElement(id, []byte(value))
+}
+
+// A Void element with a total length of n (at least 2) bytes
+func ebmlVoid(n int) []byte {
+	sizeLen := 1
+	if n-2 >= 127 {
+		sizeLen = 8
+	}
+	b := append([]byte{0xec}, ebmlSizeFixed(uint64(n-1-sizeLen), sizeLen)...)
+	return append(b, make([]byte, n-1-sizeLen)...)
+}
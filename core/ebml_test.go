@@ -0,0 +1,46 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEbmlEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want []byte
+	}{
+		{"id 1 byte", ebmlId(mkvIdTrackEntry), []byte{0xae}},
+		{"id 2 bytes", ebmlId(mkvIdSeek), []byte{0x4d, 0xbb}},
+		{"id 3 bytes", ebmlId(mkvIdTimestampScale), []byte{0x2a, 0xd7, 0xb1}},
+		{"id 4 bytes", ebmlId(mkvIdSegment), []byte{0x18, 0x53, 0x80, 0x67}},
+		{"size 0", ebmlSize(0), []byte{0x80}},
+		{"size 126", ebmlSize(126), []byte{0xfe}},
+		// 127 would be the reserved value of the 1 byte length
+		{"size 127", ebmlSize(127), []byte{0x40, 0x7f}},
+		{"size 16382", ebmlSize(16382), []byte{0x7f, 0xfe}},
+		{"size 16383", ebmlSize(16383), []byte{0x20, 0x3f, 0xff}},
+		{"size fixed", ebmlSizeFixed(5, 8), []byte{0x01, 0, 0, 0, 0, 0, 0, 5}},
+		{"uint 0", ebmlUint(mkvIdTrackNumber, 0), []byte{0xd7, 0x81, 0x00}},
+		{"uint", ebmlUint(mkvIdTimestampScale, mkvTimestampScale), []byte{0x2a, 0xd7, 0xb1, 0x83, 0x0f, 0x42, 0x40}},
+		{"uint fixed", ebmlUintFixed(mkvIdSeekPosition, 1), []byte{0x53, 0xac, 0x88, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{"float", ebmlFloat(mkvIdDuration, 1), []byte{0x44, 0x89, 0x88, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0}},
+		{"string", ebmlString(mkvIdCodecId, "A_AAC"), []byte{0x86, 0x85, 'A', '_', 'A', 'A', 'C'}},
+		{"element", ebmlElement(mkvIdVideo, []byte{1, 2}, []byte{3}), []byte{0xe0, 0x83, 1, 2, 3}},
+		{"void 2 bytes", ebmlVoid(2), []byte{0xec, 0x80}},
+	}
+	for _, tt := range tests {
+		if !bytes.Equal(tt.got, tt.want) {
+			t.Errorf("%v: % x instead of % x", tt.name, tt.got, tt.want)
+		}
+	}
+	// the total length of void elements is exact, also with 8 byte sizes
+	for _, n := range []int{2, 3, 128, 129, 130, mkvSeekHeadSize, 1000} {
+		if v := ebmlVoid(n); len(v) != n || v[0] != 0xec {
+			t.Errorf("void of %v bytes: %v bytes", n, len(v))
+		}
+	}
+}
@@ -2,11 +2,20 @@
 
 package core
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type HttpStatusCodeError struct {
 	Url        string
 	StatusCode int
+	RetryAfter time.Duration // 0 if the server didn't send a Retry-After header
+}
+
+// Client errors won't go away by retrying, except for timeouts and rate-limiting
+func (err *HttpStatusCodeError) Permanent() bool {
+	return err.StatusCode >= 400 && err.StatusCode < 500 && err.StatusCode != 408 && err.StatusCode != 429
 }
 
 func (err *HttpStatusCodeError) Error() string {
@@ -20,6 +29,10 @@ func (err *HttpStatusCodeError) Error() string {
 		e = "Forbidden"
 	case 404:
 		e = "Not Found"
+	case 408:
+		e = "Request Timeout"
+	case 429:
+		e = "Too Many Requests"
 	case 500, 502, 504:
 		e = "Server Error"
 	case 503:
@@ -46,6 +59,15 @@ func (err *FormatNotFoundError) Error() string {
 	return "format " + err.FormatName + " is not available"
 }
 
+type FormatExpressionError struct {
+	Expression string
+	Msg        string
+}
+
+func (err *FormatExpressionError) Error() string {
+	return fmt.Sprintf("invalid format expression '%v': %v", err.Expression, err.Msg)
+}
+
 type ChapterNotFoundError struct {
 	ChapterNum int
 }
@@ -75,3 +97,165 @@ type DownloadInfoFileReadError struct {}
 func (err *DownloadInfoFileReadError) Error() string {
 	return "could not read download info file, can't continue download"
 }
+
+type DownloadStateMismatchError struct {
+	Field    string
+	Expected string
+	Found    string
+}
+
+func (err *DownloadStateMismatchError) Error() string {
+	return fmt.Sprintf("can't continue download - %v of the unfinished download (%v) doesn't match the requested %v (%v)", err.Field, err.Found, err.Field, err.Expected)
+}
+
+type DownloadStateVersionError struct {
+	Version int
+}
+
+func (err *DownloadStateVersionError) Error() string {
+	return fmt.Sprintf("download info file version %v is not supported by this version of lurch-dl, can't continue download", err.Version)
+}
+
+type OutputFileTruncatedError struct {
+	Filename string
+	Size     int64
+	Expected int64
+}
+
+func (err *OutputFileTruncatedError) Error() string {
+	return fmt.Sprintf("file '%v' is smaller than expected (%v instead of at least %v bytes), can't continue download", err.Filename, err.Size, err.Expected)
+}
+
+type TsParseError struct {
+	Msg string
+}
+
+func (err *TsParseError) Error() string {
+	return "could not parse MPEG-TS data: " + err.Msg
+}
+
+type ContainerUnsupportedError struct {
+	Container string
+}
+
+func (err *ContainerUnsupportedError) Error() string {
+	return fmt.Sprintf("container '%v' is not supported", err.Container)
+}
+
+type SinkNotResumableError struct{}
+
+func (err *SinkNotResumableError) Error() string {
+	return "the download can't be continued with this output"
+}
+
+type SinkOffsetMismatchError struct {
+	Offset   int64
+	Expected int64
+}
+
+func (err *SinkOffsetMismatchError) Error() string {
+	return fmt.Sprintf("outputs can't continue at the same position (%v and %v bytes)", err.Expected, err.Offset)
+}
+
+type SinkContainerError struct {
+	Container string
+}
+
+func (err *SinkContainerError) Error() string {
+	return fmt.Sprintf("container '%v' can only be written into a file", err.Container)
+}
+
+type LayoutUnsupportedError struct {
+	Layout string
+}
+
+func (err *LayoutUnsupportedError) Error() string {
+	return fmt.Sprintf("layout '%v' is not supported", err.Layout)
+}
+
+type LayoutContainerError struct {
+	Layout    string
+	Container string
+}
+
+func (err *LayoutContainerError) Error() string {
+	return fmt.Sprintf("container '%v' can't be used with layout '%v'", err.Container, err.Layout)
+}
+
+type LayoutPreciseCutError struct {
+	Layout string
+}
+
+func (err *LayoutPreciseCutError) Error() string {
+	return fmt.Sprintf("precise cuts can't be used with layout '%v'", err.Layout)
+}
+
+type LayoutSinkError struct {
+	Layout string
+}
+
+func (err *LayoutSinkError) Error() string {
+	return fmt.Sprintf("layout '%v' can't be used with a sink", err.Layout)
+}
+
+type ChunkValidationError struct {
+	Url string
+	Msg string
+}
+
+func (err *ChunkValidationError) Error() string {
+	return fmt.Sprintf("invalid chunk %v: %v", err.Url, err.Msg)
+}
+
+type HttpContentLengthError struct {
+	Url      string
+	Size     int
+	Expected int64
+}
+
+func (err *HttpContentLengthError) Error() string {
+	return fmt.Sprintf("got %v of %v bytes while fetching %v", err.Size, err.Expected, err.Url)
+}
+
+type EncryptionUnsupportedError struct {
+	Method    string
+	KeyFormat string
+}
+
+func (err *EncryptionUnsupportedError) Error() string {
+	if err.KeyFormat != "" && err.KeyFormat != "identity" {
+		return fmt.Sprintf("encryption method %v with key format '%v' is not supported", err.Method, err.KeyFormat)
+	}
+	return fmt.Sprintf("encryption method %v is not supported, only AES-128", err.Method)
+}
+
+type EncryptionKeyError struct {
+	Url  string
+	Size int
+}
+
+func (err *EncryptionKeyError) Error() string {
+	return fmt.Sprintf("the key %v has %v bytes instead of 16", err.Url, err.Size)
+}
+
+type LiveStreamOfflineError struct{}
+
+func (err *LiveStreamOfflineError) Error() string {
+	return "the channel is not live right now"
+}
+
+type LiveDownloadError struct {
+	Msg string
+}
+
+func (err *LiveDownloadError) Error() string {
+	return "live download: " + err.Msg
+}
+
+type PlaylistTagUnsupportedError struct {
+	Tag string
+}
+
+func (err *PlaylistTagUnsupportedError) Error() string {
+	return fmt.Sprintf("playlists with %v tags are not supported", err.Tag)
+}
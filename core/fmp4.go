@@ -0,0 +1,236 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"cmp"
+	"encoding/binary"
+	"io"
+	"slices"
+)
+
+// Sample flags (ISO/IEC 14496-12, 8.8.3.1)
+const (
+	mp4SampleFlagsSync    = 0x02000000 // depends on no other sample
+	mp4SampleFlagsNonSync = 0x01010000 // depends on others, non-sync sample
+)
+
+type Mp4TrackState struct {
+	Pid       uint16 `json:"pid"`
+	Id        uint32 `json:"id"`
+	Timescale uint32 `json:"timescale"`
+	// The parameter sets of video tracks
+	Hevc bool   `json:"hevc,omitempty"`
+	Vps  []byte `json:"vps,omitempty"`
+	Sps  []byte `json:"sps,omitempty"`
+	Pps  []byte `json:"pps,omitempty"`
+}
+
+// The configured video track for the chunks after the first one, they
+// don't have to start with a keyframe that comes with the parameter sets
+func (t *Mp4TrackState) videoTrack() *mediaTrack {
+	return &mediaTrack{pid: t.Pid, video: true, configured: true, hevc: t.Hevc, vps: t.Vps, sps: t.Sps, pps: t.Pps}
+}
+
+// The state of a fragmented MP4 download, so it can be continued
+type Mp4State struct {
+	Tracks         []Mp4TrackState `json:"tracks"`
+	SequenceNumber uint32          `json:"sequence_number"`
+	// 90 kHz clock, see tsFrameReader.unwrap()
+	TimeBase int64 `json:"time_base"`
+	ClockRaw int64 `json:"clock_raw"`
+	Clock    int64 `json:"clock"`
+	End      int64 `json:"end"`
+	// File offset of the duration in the mehd box
+	DurationPos int64 `json:"duration_pos"`
+	// Only the audio tracks, for ContainerM4a
+	AudioOnly bool `json:"audio_only,omitempty"`
+}
+
+// Converts the TS chunks of a download into the fragments of a
+// fragmented MP4 file. The first fragment is preceded by the init
+// segment. All state needed to continue later is kept in state.
+type fmp4Muxer struct {
+	state *Mp4State
+	// Written into the init segment (optional)
+	chapters []mp4Chapter
+}
+
+// Convert a TS chunk that will be written at offset into a fragment
+func (m *fmp4Muxer) fragment(data []byte, offset int64) ([]byte, error) {
+	frames := []*mediaFrame{}
+	reader := newTsFrameReader(func(f *mediaFrame) {
+		if !m.state.AudioOnly || !f.track.video {
+			frames = append(frames, f)
+		}
+	})
+	if m.state.SequenceNumber > 0 {
+		reader.clockInit = true
+		reader.lastRaw, reader.last = m.state.ClockRaw, m.state.Clock
+		for i := range m.state.Tracks {
+			if m.state.Tracks[i].Sps != nil {
+				reader.tracks[m.state.Tracks[i].Pid] = m.state.Tracks[i].videoTrack()
+			}
+		}
+	}
+	reader.Write(data)
+	reader.flush()
+	if len(frames) == 0 {
+		return nil, nil
+	}
+	m.state.ClockRaw, m.state.Clock = reader.lastRaw, reader.last
+	out := []byte{}
+	if m.state.SequenceNumber == 0 {
+		init, err := m.initSegment(frames, offset)
+		if err != nil {
+			return nil, err
+		}
+		out = init
+	}
+	m.state.SequenceNumber++
+	// the samples of each track
+	samples := map[uint16][]*mediaFrame{}
+	for _, f := range frames {
+		samples[f.track.pid] = append(samples[f.track.pid], f)
+	}
+	trafs := [][]byte{}
+	mdat := []byte{}
+	dataOffsets := []int{} // positions of the data offsets in the trafs
+	for _, t := range m.state.Tracks {
+		trackSamples := samples[t.Pid]
+		if len(trackSamples) == 0 {
+			continue
+		}
+		sampleData := make([][]byte, len(trackSamples))
+		for i, f := range trackSamples {
+			sampleData[i] = f.data
+			if f.track.video {
+				sampleData[i] = f.track.lengthPrefixed(f.data)
+			}
+		}
+		traf, offsetPos := m.traf(&t, trackSamples, sampleData, len(mdat))
+		dataOffsets = append(dataOffsets, offsetPos)
+		trafs = append(trafs, traf)
+		for _, d := range sampleData {
+			mdat = append(mdat, d...)
+		}
+	}
+	if len(trafs) == 0 {
+		return out, nil
+	}
+	moof := mp4Box("moof", append([][]byte{mp4FullBox("mfhd", 0, 0, be32(m.state.SequenceNumber))}, trafs...)...)
+	// the data offsets are relative to the start of the moof box
+	pos := 8 + 16 // moof header, mfhd
+	for i, traf := range trafs {
+		p := moof[pos+dataOffsets[i]:]
+		binary.BigEndian.PutUint32(p, binary.BigEndian.Uint32(p)+uint32(len(moof)+8))
+		pos += len(traf)
+	}
+	out = append(out, moof...)
+	return append(out, mp4Box("mdat", mdat)...), nil
+}
+
+func (m *fmp4Muxer) initSegment(frames []*mediaFrame, offset int64) ([]byte, error) {
+	// video first, then audio
+	tracks := []*mediaTrack{}
+	m.state.TimeBase = frames[0].dts
+	for _, f := range frames {
+		if !slices.Contains(tracks, f.track) {
+			tracks = append(tracks, f.track)
+		}
+		m.state.TimeBase = min(m.state.TimeBase, f.dts)
+	}
+	slices.SortStableFunc(tracks, func(a *mediaTrack, b *mediaTrack) int {
+		if a.video == b.video {
+			return cmp.Compare(a.pid, b.pid)
+		} else if a.video {
+			return -1
+		}
+		return 1
+	})
+	m.state.End = m.state.TimeBase
+	traks := [][]byte{}
+	trexs := [][]byte{}
+	for i, t := range tracks {
+		track := mp4Track{id: uint32(i + 1), timescale: tsClockRate, media: t}
+		if !t.video {
+			track.timescale = uint32(t.sampleRate)
+		}
+		m.state.Tracks = append(m.state.Tracks, Mp4TrackState{
+			Pid: t.pid, Id: track.id, Timescale: track.timescale,
+			Hevc: t.hevc, Vps: t.vps, Sps: t.sps, Pps: t.pps,
+		})
+		traks = append(traks, mp4Trak(&track))
+		trexs = append(trexs, mp4FullBox("trex", 0, 0, be32(track.id), be32(1), be32(0), be32(0), be32(0)))
+	}
+	if len(traks) == 0 {
+		return nil, &TsParseError{Msg: "no H.264 video or AAC audio found"}
+	}
+	mehd := mp4FullBox("mehd", 1, 0, be64(0)) // the duration is written at the end
+	mvex := mp4Box("mvex", append([][]byte{mehd}, trexs...)...)
+	boxes := append([][]byte{mp4Mvhd(0, uint32(len(traks)+1))}, traks...)
+	if len(m.chapters) > 0 {
+		boxes = append(boxes, mp4Box("udta", mp4Chpl(m.chapters)))
+	}
+	moov := mp4Box("moov", append(boxes, mvex)...)
+	init := append(mp4Ftyp(), moov...)
+	// mvex is the last box, mehd the first one in it
+	m.state.DurationPos = offset + int64(len(init)-len(mvex)) + 8 + 12
+	return init, nil
+}
+
+// Returns the traf box and the position of the data offset in it. The
+// data offset is relative to the mdat payload and has to be corrected.
+func (m *fmp4Muxer) traf(t *Mp4TrackState, samples []*mediaFrame, sampleData [][]byte, dataOffset int) ([]byte, int) {
+	scale := func(ticks int64) int64 {
+		return ticks * int64(t.Timescale) / tsClockRate
+	}
+	decodeTime := scale(samples[0].dts - m.state.TimeBase)
+	video := samples[0].track.video
+	flags := uint32(0x000001 | 0x000100 | 0x000200 | 0x000400) // data offset, sample duration, size and flags
+	if video {
+		flags |= 0x000800 // composition time offsets
+	}
+	entries := []byte{}
+	var lastDuration int64
+	for i, f := range samples {
+		var duration int64
+		switch {
+		case !video:
+			// exact, the sample rate is the timescale
+			duration = aacSamplesPerFrame
+		case i+1 < len(samples):
+			duration = scale(samples[i+1].dts - f.dts)
+		case lastDuration > 0:
+			// the next frame is in the next chunk
+			duration = lastDuration
+		default:
+			duration = scale(tsClockRate / 30)
+		}
+		lastDuration = duration
+		m.state.End = max(m.state.End, f.pts+duration*tsClockRate/int64(t.Timescale))
+		sampleFlags := uint32(mp4SampleFlagsNonSync)
+		if f.keyframe {
+			sampleFlags = mp4SampleFlagsSync
+		}
+		entries = binary.BigEndian.AppendUint32(entries, uint32(duration))
+		entries = binary.BigEndian.AppendUint32(entries, uint32(len(sampleData[i])))
+		entries = binary.BigEndian.AppendUint32(entries, sampleFlags)
+		if video {
+			entries = binary.BigEndian.AppendUint32(entries, uint32(int32(scale(f.pts-f.dts))))
+		}
+	}
+	tfhd := mp4FullBox("tfhd", 0, 0x020000, be32(t.Id)) // default base is moof
+	tfdt := mp4FullBox("tfdt", 1, 0, be64(uint64(max(decodeTime, 0))))
+	trun := mp4FullBox("trun", 1, flags, be32(uint32(len(samples))), be32(uint32(dataOffset)), entries)
+	traf := mp4Box("traf", tfhd, tfdt, trun)
+	// box header, tfhd, tfdt, trun header and sample count
+	return traf, 8 + len(tfhd) + len(tfdt) + 12 + 4
+}
+
+// Write the duration into the init segment
+func finishFmp4(w io.WriterAt, state *Mp4State) error {
+	duration := (state.End - state.TimeBase) * mp4MovieTimescale / tsClockRate
+	_, err := w.WriteAt(be64(uint64(duration)), state.DurationPos)
+	return err
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testMp4ContainerBoxes = []string{"moov", "trak", "mdia", "minf", "stbl", "dinf", "udta", "mvex", "moof", "traf"}
+
+type testMp4Box struct {
+	typ      string
+	pos      int // in the file
+	payload  []byte
+	children []testMp4Box
+}
+
+// Parse the boxes in data, the sizes of all boxes have to add up exactly
+// to the size of their parent
+func testParseMp4(t *testing.T, data []byte, pos int) []testMp4Box {
+	t.Helper()
+	boxes := []testMp4Box{}
+	for len(data) > 0 {
+		if len(data) < 8 {
+			t.Fatalf("%v bytes left at %v", len(data), pos)
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		if size < 8 || size > len(data) {
+			t.Fatalf("box %q at %v: size %v, %v bytes left", data[4:8], pos, size, len(data))
+		}
+		b := testMp4Box{typ: string(data[4:8]), pos: pos, payload: data[8:size]}
+		if slices.Contains(testMp4ContainerBoxes, b.typ) {
+			b.children = testParseMp4(t, b.payload, pos+8)
+		}
+		boxes = append(boxes, b)
+		data, pos = data[size:], pos+size
+	}
+	return boxes
+}
+
+// All boxes of a type, in the whole tree
+func testFindMp4(boxes []testMp4Box, typ string) []testMp4Box {
+	found := []testMp4Box{}
+	for _, b := range boxes {
+		if b.typ == typ {
+			found = append(found, b)
+		}
+		found = append(found, testFindMp4(b.children, typ)...)
+	}
+	return found
+}
+
+type testMp4Sample struct {
+	duration uint32
+	size     uint32
+	sync     bool
+	data     []byte
+}
+
+type testMp4Fragment struct {
+	decodeTime map[uint32]uint64 // per track id
+	samples    map[uint32][]testMp4Sample
+}
+
+// The samples of the fragments of a file, their data is read from the
+// data offsets of the trun boxes
+func testMp4Fragments(t *testing.T, data []byte, boxes []testMp4Box) []testMp4Fragment {
+	t.Helper()
+	fragments := []testMp4Fragment{}
+	for _, moof := range testFindMp4(boxes, "moof") {
+		fragment := testMp4Fragment{decodeTime: map[uint32]uint64{}, samples: map[uint32][]testMp4Sample{}}
+		for _, traf := range testFindMp4(moof.children, "traf") {
+			tfhd, tfdt, trun := testFindMp4(traf.children, "tfhd"), testFindMp4(traf.children, "tfdt"), testFindMp4(traf.children, "trun")
+			if len(tfhd) != 1 || len(tfdt) != 1 || len(trun) != 1 {
+				t.Fatalf("traf at %v: %v tfhd, %v tfdt, %v trun", traf.pos, len(tfhd), len(tfdt), len(trun))
+			}
+			id := binary.BigEndian.Uint32(tfhd[0].payload[4:])
+			fragment.decodeTime[id] = binary.BigEndian.Uint64(tfdt[0].payload[4:])
+			p := trun[0].payload
+			flags := binary.BigEndian.Uint32(p) & 0xffffff
+			count := int(binary.BigEndian.Uint32(p[4:]))
+			offset := moof.pos + int(int32(binary.BigEndian.Uint32(p[8:])))
+			entrySize := 12
+			if flags&0x800 != 0 {
+				entrySize = 16
+			}
+			if len(p) != 12+count*entrySize {
+				t.Fatalf("trun at %v: %v bytes for %v samples", trun[0].pos, len(p), count)
+			}
+			for i := range count {
+				e := p[12+i*entrySize:]
+				s := testMp4Sample{
+					duration: binary.BigEndian.Uint32(e),
+					size:     binary.BigEndian.Uint32(e[4:]),
+					sync:     binary.BigEndian.Uint32(e[8:]) == mp4SampleFlagsSync,
+				}
+				if offset+int(s.size) > len(data) {
+					t.Fatalf("sample %v of track %v is outside of the file", i, id)
+				}
+				s.data = data[offset : offset+int(s.size)]
+				offset += int(s.size)
+				fragment.samples[id] = append(fragment.samples[id], s)
+			}
+		}
+		fragments = append(fragments, fragment)
+	}
+	return fragments
+}
+
+// Mux the chunks like a download: the state is saved and read again
+// between the chunks
+func testMuxFmp4(t *testing.T, state Mp4State, chapters []mp4Chapter, chunks ...[]byte) []byte {
+	t.Helper()
+	output := filepath.Join(t.TempDir(), "test.mp4")
+	f, err := os.Create(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	offset := int64(0)
+	for _, chunk := range chunks {
+		muxer := fmp4Muxer{state: &state, chapters: chapters}
+		data, err := muxer.fragment(chunk, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		offset += int64(len(data))
+		saved, err := json.Marshal(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state = Mp4State{}
+		if err := json.Unmarshal(saved, &state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := finishFmp4(f, &state); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFmp4(t *testing.T) {
+	w := newTestTsWriter(tsStreamTypeH264)
+	chunks := [][]byte{
+		w.chunk(10*tsClockRate, 60, testKeyframes(0, 30)),
+		// the second chunk doesn't start with a keyframe
+		w.chunk(12*tsClockRate, 60, testKeyframes(30)),
+	}
+	data := testMuxFmp4(t, Mp4State{}, nil, chunks...)
+	boxes := testParseMp4(t, data, 0)
+	var types []string
+	for _, b := range boxes {
+		types = append(types, b.typ)
+	}
+	if !slices.Equal(types, []string{"ftyp", "moov", "moof", "mdat", "moof", "mdat"}) {
+		t.Fatalf("top level boxes %v", types)
+	}
+	// video first
+	handlers := testFindMp4(boxes, "hdlr")
+	if len(handlers) != 2 || string(handlers[0].payload[8:12]) != "vide" || string(handlers[1].payload[8:12]) != "soun" {
+		t.Fatalf("%v tracks", len(handlers))
+	}
+	// the avcC box follows the fields of the avc1 sample entry
+	stsd := testFindMp4(boxes, "stsd")[0]
+	sampleEntry := testParseMp4(t, stsd.payload[8:], 0)
+	if len(sampleEntry) != 1 || sampleEntry[0].typ != "avc1" {
+		t.Fatalf("sample entries %+v", sampleEntry)
+	}
+	avcC := testParseMp4(t, sampleEntry[0].payload[78:], 0)
+	if len(avcC) != 1 || avcC[0].typ != "avcC" || !bytes.Equal(avcC[0].payload, avcDecoderConfig(testH264Sps, testH264Pps)) {
+		t.Errorf("avcC %+v", avcC)
+	}
+	mehd := testFindMp4(boxes, "mehd")
+	if duration := binary.BigEndian.Uint64(mehd[0].payload[4:]); duration != (180000+94*testAudioTicks)/90 {
+		t.Errorf("duration %v ms", duration)
+	}
+	fragments := testMp4Fragments(t, data, boxes)
+	if len(fragments) != 2 {
+		t.Fatalf("%v fragments", len(fragments))
+	}
+	for i, fragment := range fragments {
+		video, audio := fragment.samples[1], fragment.samples[2]
+		if len(video) != 60 || len(audio) != 94 {
+			t.Errorf("fragment %v: %v video and %v audio samples", i, len(video), len(audio))
+		}
+		if fragment.decodeTime[1] != uint64(i*180000) || fragment.decodeTime[2] != uint64(i*96000) {
+			t.Errorf("fragment %v: decode times %v", i, fragment.decodeTime)
+		}
+		for j, s := range video {
+			keyframe := j == 30 || (i == 0 && j == 0)
+			// length prefixed, without the access unit delimiter
+			size := 4 + 305
+			if keyframe {
+				size += 4 + len(testH264Sps) + 4 + len(testH264Pps)
+			}
+			if s.duration != testFrameTicks || s.sync != keyframe || int(s.size) != size {
+				t.Errorf("fragment %v, video sample %v: %+v", i, j, s)
+			}
+			if first := binary.BigEndian.Uint32(s.data); (keyframe && first != uint32(len(testH264Sps))) || (!keyframe && first != 305) {
+				t.Errorf("fragment %v, video sample %v starts with % x", i, j, s.data[:8])
+			}
+		}
+		for j, s := range audio {
+			if s.duration != aacSamplesPerFrame || !s.sync || !bytes.Equal(s.data, bytes.Repeat([]byte{0x21}, 20)) {
+				t.Errorf("fragment %v, audio sample %v: %+v", i, j, s)
+			}
+		}
+	}
+}
+
+func TestFmp4AudioOnly(t *testing.T) {
+	w := newTestTsWriter(tsStreamTypeH264)
+	chunks := [][]byte{w.chunk(0, 60, testKeyframes(0)), w.chunk(2*tsClockRate, 60, testKeyframes(0))}
+	chapters := []mp4Chapter{{start: 0, title: "Just Chatting"}, {start: time.Second, title: "Minecraft"}}
+	data := testMuxFmp4(t, Mp4State{AudioOnly: true}, chapters, chunks...)
+	boxes := testParseMp4(t, data, 0)
+	if handlers := testFindMp4(boxes, "hdlr"); len(handlers) != 1 || string(handlers[0].payload[8:12]) != "soun" {
+		t.Fatalf("%v tracks", len(handlers))
+	}
+	chpl := testFindMp4(boxes, "chpl")
+	if len(chpl) != 1 || chpl[0].payload[8] != 2 {
+		t.Errorf("chapters %+v", chpl)
+	}
+	samples := 0
+	for _, fragment := range testMp4Fragments(t, data, boxes) {
+		if len(fragment.samples) != 1 {
+			t.Errorf("%v tracks in a fragment", len(fragment.samples))
+		}
+		samples += len(fragment.samples[1])
+	}
+	if samples != 2*94 {
+		t.Errorf("%v samples", samples)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Format expressions, e.g. 720p30/720p/best
+//
+// Alternatives are separated by / and evaluated from left to right, the
+// first one that selects a format wins. An alternative is the name of a
+// format, one of the keywords below, or conditions joined by &:
+//
+//	720p, 720p30     the height and optionally the frame rate
+//	<=720p, >1080p30 compares the height (and frame rate), also <, >=, !=
+//	fps>=50          compares the frame rate
+//	bw<3M            compares the bandwidth in Bits/s, with k, M or G
+//	codec=hevc       the codec, h264 or hevc, also !=
+//
+// The best of the matching formats is selected.
+const (
+	FormatBest     = "best"
+	FormatWorst    = "worst"
+	FormatAuto     = "auto"      // the same as best
+	FormatAutoHevc = "auto-hevc" // best, but HEVC is preferred
+)
+
+var formatConditionRegex = regexp.MustCompile(`^([a-z]*)(<=|>=|!=|<|>|=)?(.*)$`)
+var formatResolutionRegex = regexp.MustCompile(`^([0-9]+)p([0-9]+(?:\.[0-9]+)?)?$`)
+
+type formatCondition func(f *VideoFormat) bool
+
+// Compare the quality of two formats: the resolution, frame rate and
+// bandwidth, then the position in the playlist (the last one is best)
+func compareFormatQuality(a *VideoFormat, ai int, b *VideoFormat, bi int) int {
+	return cmp.Or(
+		cmp.Compare(a.Height, b.Height),
+		cmp.Compare(a.FrameRate, b.FrameRate),
+		cmp.Compare(a.Bandwidth, b.Bandwidth),
+		cmp.Compare(ai, bi))
+}
+
+// Frame rates like 29.97 and 30 are considered equal
+func roundFrameRate(fps float64) float64 {
+	return math.Round(fps)
+}
+
+func parseBandwidth(value string) (int, error) {
+	s := value
+	factor := 1.0
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		factor = 1e3
+	case 'm', 'M':
+		factor = 1e6
+	case 'g', 'G':
+		factor = 1e9
+	}
+	if factor > 1 {
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid bandwidth '%v', e.g. 3M or 2500k", value)
+	}
+	return int(v * factor), nil
+}
+
+func parseFormatCondition(s string) (formatCondition, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty condition")
+	}
+	m := formatConditionRegex.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("invalid condition '%v'", s)
+	}
+	field, op, value := m[1], m[2], m[3]
+	if op == "" {
+		if field != "" {
+			return nil, fmt.Errorf("operator missing after '%v' in '%v'", field, s)
+		}
+		op = "="
+	}
+	if value == "" {
+		return nil, fmt.Errorf("value missing after '%v%v' in '%v'", field, op, s)
+	}
+	var compare func(f *VideoFormat) int
+	switch field {
+	case "":
+		r := formatResolutionRegex.FindStringSubmatch(value)
+		if r == nil {
+			return nil, fmt.Errorf("invalid resolution '%v', e.g. 720p or 720p30", value)
+		}
+		height, _ := strconv.Atoi(r[1])
+		fps, _ := strconv.ParseFloat(r[2], 64)
+		compare = func(f *VideoFormat) int {
+			c := cmp.Compare(f.Height, height)
+			if c == 0 && r[2] != "" {
+				c = cmp.Compare(roundFrameRate(f.FrameRate), roundFrameRate(fps))
+			}
+			return c
+		}
+	case "fps":
+		fps, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame rate '%v'", value)
+		}
+		compare = func(f *VideoFormat) int {
+			return cmp.Compare(roundFrameRate(f.FrameRate), roundFrameRate(fps))
+		}
+	case "bw":
+		bandwidth, err := parseBandwidth(value)
+		if err != nil {
+			return nil, err
+		}
+		compare = func(f *VideoFormat) int {
+			return cmp.Compare(f.Bandwidth, bandwidth)
+		}
+	case "codec":
+		if value != VideoCodecH264 && value != VideoCodecHevc {
+			return nil, fmt.Errorf("unknown codec '%v', expected %v or %v", value, VideoCodecH264, VideoCodecHevc)
+		}
+		if op != "=" && op != "!=" {
+			return nil, fmt.Errorf("codecs can only be compared with = or !=")
+		}
+		compare = func(f *VideoFormat) int {
+			if f.Codec == value {
+				return 0
+			}
+			return 1
+		}
+	default:
+		return nil, fmt.Errorf("unknown field '%v', expected fps, bw or codec", field)
+	}
+	return func(f *VideoFormat) bool {
+		c := compare(f)
+		switch op {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		case "!=":
+			return c != 0
+		default:
+			return c == 0
+		}
+	}, nil
+}
+
+type formatAlternative struct {
+	name       string
+	keyword    string
+	conditions []formatCondition
+}
+
+func parseFormatExpression(expr string) ([]formatAlternative, error) {
+	alternatives := []formatAlternative{}
+	for a := range strings.SplitSeq(expr, "/") {
+		a = strings.TrimSpace(a)
+		alt := formatAlternative{name: a}
+		switch a {
+		case "":
+			return nil, &FormatExpressionError{Expression: expr, Msg: "empty alternative"}
+		case FormatAuto, FormatAutoHevc, FormatBest, FormatWorst:
+			alt.keyword = a
+		default:
+			for c := range strings.SplitSeq(a, "&") {
+				c = strings.TrimSpace(c)
+				if c == FormatAuto || c == FormatAutoHevc || c == FormatBest || c == FormatWorst {
+					return nil, &FormatExpressionError{Expression: expr, Msg: fmt.Sprintf("'%v' can't be combined with conditions", c)}
+				}
+				condition, err := parseFormatCondition(c)
+				if err != nil {
+					if !strings.ContainsAny(a, "<>=&") {
+						// probably the name of a format that is missing
+						alt.conditions = nil
+						break
+					}
+					return nil, &FormatExpressionError{Expression: expr, Msg: err.Error()}
+				}
+				alt.conditions = append(alt.conditions, condition)
+			}
+		}
+		alternatives = append(alternatives, alt)
+	}
+	return alternatives, nil
+}
+
+// Select a format by its name or a format expression. Unless a codec is
+// part of the expression, H.264 formats are preferred, or HEVC formats
+// with preferHevc.
+func (ep *StreamEpisode) SelectFormat(expr string, preferHevc bool) (VideoFormat, error) {
+	alternatives, err := parseFormatExpression(expr)
+	if err != nil {
+		return VideoFormat{}, err
+	}
+	for _, alt := range alternatives {
+		for _, f := range ep.Formats {
+			if f.Name == alt.name {
+				return f, nil
+			}
+		}
+		if alt.keyword == "" && len(alt.conditions) == 0 {
+			continue
+		}
+		matching := []int{}
+		for i := range ep.Formats {
+			ok := true
+			for _, condition := range alt.conditions {
+				ok = ok && condition(&ep.Formats[i])
+			}
+			if ok {
+				matching = append(matching, i)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+		preferred := VideoCodecH264
+		if preferHevc || alt.keyword == FormatAutoHevc {
+			preferred = VideoCodecHevc
+		}
+		selected := -1
+		for _, i := range matching {
+			f := &ep.Formats[i]
+			if selected < 0 {
+				selected = i
+				continue
+			}
+			s := &ep.Formats[selected]
+			if (f.Codec == preferred) != (s.Codec == preferred) {
+				if f.Codec == preferred {
+					selected = i
+				}
+				continue
+			}
+			c := compareFormatQuality(f, i, s, selected)
+			if (alt.keyword == FormatWorst && c < 0) || (alt.keyword != FormatWorst && c > 0) {
+				selected = i
+			}
+		}
+		return ep.Formats[selected], nil
+	}
+	return VideoFormat{}, &FormatNotFoundError{FormatName: expr}
+}
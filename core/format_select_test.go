@@ -0,0 +1,133 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testFormats = []VideoFormat{
+	{Name: "360p", Width: 640, Height: 360, FrameRate: 30, Bandwidth: 800_000, Codec: VideoCodecH264},
+	{Name: "720p", Width: 1280, Height: 720, FrameRate: 29.97, Bandwidth: 3_000_000, Codec: VideoCodecH264},
+	{Name: "720p60", Width: 1280, Height: 720, FrameRate: 60, Bandwidth: 4_500_000, Codec: VideoCodecH264},
+	{Name: "1080p60", Width: 1920, Height: 1080, FrameRate: 60, Bandwidth: 6_000_000, Codec: VideoCodecH264},
+	{Name: "1080p60-hevc", Width: 1920, Height: 1080, FrameRate: 60, Bandwidth: 4_000_000, Codec: VideoCodecHevc},
+}
+
+func TestSelectFormat(t *testing.T) {
+	ep := StreamEpisode{Formats: testFormats}
+	tests := []struct {
+		expr       string
+		preferHevc bool
+		want       string
+	}{
+		// keywords
+		{"best", false, "1080p60"},
+		{"auto", false, "1080p60"},
+		{"worst", false, "360p"},
+		// the preferred codec wins over the quality
+		{"best", true, "1080p60-hevc"},
+		{"auto-hevc", false, "1080p60-hevc"},
+		{"worst", true, "1080p60-hevc"},
+		{"bw<5M", false, "720p60"},
+		{"bw<5M", true, "1080p60-hevc"},
+		// names are matched before conditions
+		{"720p", false, "720p"},
+		{"720p60", false, "720p60"},
+		{"1080p60-hevc", false, "1080p60-hevc"},
+		// resolutions, frame rates are rounded
+		{"720p30", false, "720p"},
+		{"<=720p", false, "720p60"},
+		{"<720p", false, "360p"},
+		{">=1080p", false, "1080p60"},
+		{">720p30", false, "1080p60"},
+		{"!=1080p", false, "720p60"},
+		{"=360p", false, "360p"},
+		// fields and conjunctions
+		{"fps<50", false, "720p"},
+		{"fps>=50 & <=720p", false, "720p60"},
+		{"bw<3M", false, "360p"},
+		{"bw<=3M", false, "720p"},
+		{"bw<=3000k", false, "720p"},
+		{"bw>0.005G", false, "1080p60"},
+		{"codec=hevc", false, "1080p60-hevc"},
+		{"codec!=hevc", true, "1080p60"},
+		{"codec=h264 & <=720p", false, "720p60"},
+		// fallbacks from left to right
+		{"1440p/720p30/best", false, "720p"},
+		{"1440p / missing / worst", false, "360p"},
+		{"720p/best", false, "720p"},
+		{"fps>60/codec=hevc&<=720p/bw<1M", false, "360p"},
+	}
+	for _, tt := range tests {
+		f, err := ep.SelectFormat(tt.expr, tt.preferHevc)
+		if err != nil {
+			t.Errorf("%q (prefer HEVC: %v): %v", tt.expr, tt.preferHevc, err)
+		} else if f.Name != tt.want {
+			t.Errorf("%q (prefer HEVC: %v): %v instead of %v", tt.expr, tt.preferHevc, f.Name, tt.want)
+		}
+	}
+}
+
+func TestSelectFormatTies(t *testing.T) {
+	// the bandwidth, then the position in the playlist decides
+	ep := StreamEpisode{Formats: []VideoFormat{
+		{Name: "a", Height: 720, FrameRate: 30, Bandwidth: 2_000_000},
+		{Name: "b", Height: 720, FrameRate: 30, Bandwidth: 3_000_000},
+		{Name: "c", Height: 720, FrameRate: 30, Bandwidth: 3_000_000},
+	}}
+	for expr, want := range map[string]string{"best": "c", "worst": "a", "bw<3M": "a"} {
+		if f, err := ep.SelectFormat(expr, false); err != nil || f.Name != want {
+			t.Errorf("%q: %v, %v instead of %v", expr, f.Name, err, want)
+		}
+	}
+}
+
+func TestSelectFormatErrors(t *testing.T) {
+	ep := StreamEpisode{Formats: testFormats}
+	tests := []struct {
+		expr string
+		msg  string // part of the FormatExpressionError, "" for a FormatNotFoundError
+	}{
+		{"1440p", ""},
+		{"missing", ""},
+		{"fps>60", ""},
+		{"codec=hevc&<1080p", ""},
+		{"1440p/missing", ""},
+		{"fps50", ""}, // a name
+		{"", "empty alternative"},
+		{"best//worst", "empty alternative"},
+		{"720p&", "empty condition"},
+		{"<=", "value missing after '<='"},
+		{"bw<", "value missing after 'bw<'"},
+		{"fps50&720p", "operator missing after 'fps'"},
+		{"<=720x", "invalid resolution '720x'"},
+		{"<=p30", "invalid resolution 'p30'"},
+		{"bw<abc", "invalid bandwidth 'abc'"},
+		{"bw<M", "invalid bandwidth 'M'"},
+		{"bw>-1", "invalid bandwidth '-1'"},
+		{"fps>=x", "invalid frame rate 'x'"},
+		{"codec=av1", "unknown codec 'av1'"},
+		{"codec<hevc", "only be compared with = or !="},
+		{"res>=720p", "unknown field 'res'"},
+		{"codec=h264&worst", "'worst' can't be combined with conditions"},
+	}
+	for _, tt := range tests {
+		_, err := ep.SelectFormat(tt.expr, false)
+		if tt.msg == "" {
+			var notFoundErr *FormatNotFoundError
+			if !errors.As(err, &notFoundErr) {
+				t.Errorf("%q: expected a FormatNotFoundError, got %v", tt.expr, err)
+			}
+			continue
+		}
+		var expressionErr *FormatExpressionError
+		if !errors.As(err, &expressionErr) {
+			t.Errorf("%q: expected a FormatExpressionError, got %v", tt.expr, err)
+		} else if !strings.Contains(expressionErr.Msg, tt.msg) {
+			t.Errorf("%q: %q doesn't contain %q", tt.expr, expressionErr.Msg, tt.msg)
+		}
+	}
+}
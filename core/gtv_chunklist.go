@@ -1,28 +1,87 @@
 package core
 
-import "time"
+import (
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core/m3u8"
+)
+
+type Chunk struct {
+	Name     string        // the filename, the last element of the url path
+	Url      string        // absolute
+	Start    time.Duration // relative to the start of the uncut chunk list
+	Duration time.Duration
+	// Only for encrypted chunks
+	Key            *m3u8.Key
+	SequenceNumber int64
+}
 
 type ChunkList struct {
-	BaseUrl       string
-	Chunks        []string
-	ChunkDuration float64
+	Chunks        []Chunk
+	ChunkDuration float64 // target duration
+	FirstChunk    int // index of the first chunk in the uncut list
+	// The playlist has no EXT-X-ENDLIST tag yet, chunks are still added
+	Live bool
+}
+
+// The index of the chunk that contains the timestamp t
+func (cl *ChunkList) chunkAt(t time.Duration) int {
+	return sort.Search(len(cl.Chunks), func(i int) bool {
+		return cl.Chunks[i].Start+cl.Chunks[i].Duration > t
+	})
 }
 
 func (cl *ChunkList) Cut(from time.Duration, to time.Duration) ChunkList {
-	var newChunks []string
+	var newChunks []Chunk
 	var firstChunk = 0
 	if from != -1 {
-		firstChunk = int(from.Seconds() / cl.ChunkDuration)
+		firstChunk = min(cl.chunkAt(from), len(cl.Chunks))
 	}
 	if to != -1 {
-		lastChunk := min(int(to.Seconds()/cl.ChunkDuration)+1, len(cl.Chunks))
+		lastChunk := max(min(cl.chunkAt(to)+1, len(cl.Chunks)), firstChunk)
 		newChunks = cl.Chunks[firstChunk:lastChunk]
 	} else {
 		newChunks = cl.Chunks[firstChunk:]
 	}
 	return ChunkList{
-		BaseUrl:       cl.BaseUrl,
 		Chunks:        newChunks,
 		ChunkDuration: cl.ChunkDuration,
+		FirstChunk:    cl.FirstChunk + firstChunk,
+		Live:          cl.Live,
+	}
+}
+
+// Append the new chunks of a live playlist
+func (cl *ChunkList) extend(update *ChunkList) {
+	cl.Chunks = append(cl.Chunks, update.Chunks...)
+	cl.Live = update.Live
+}
+
+func chunkListFromPlaylist(pl *m3u8.MediaPlaylist) (ChunkList, error) {
+	chunklist := ChunkList{ChunkDuration: pl.TargetDuration.Seconds(), Live: !pl.EndList && pl.PlaylistType != m3u8.PlaylistTypeVod}
+	var start time.Duration
+	for _, s := range pl.Segments {
+		if err := checkChunkKey(s.Key); err != nil {
+			return chunklist, err
+		}
+		// chunks are always downloaded as a whole and written as they are
+		if s.ByteRange != nil {
+			return chunklist, &PlaylistTagUnsupportedError{Tag: "EXT-X-BYTERANGE"}
+		} else if s.Map != nil {
+			return chunklist, &PlaylistTagUnsupportedError{Tag: "EXT-X-MAP"}
+		}
+		name := s.Uri
+		if u, err := url.Parse(s.Uri); err == nil {
+			name = path.Base(u.Path)
+		}
+		chunklist.Chunks = append(chunklist.Chunks, Chunk{
+			Name: name, Url: s.Uri, Start: start, Duration: s.Duration,
+			Key: s.Key, SequenceNumber: s.SequenceNumber,
+		})
+		start += s.Duration
 	}
+	return chunklist, nil
 }
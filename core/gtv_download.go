@@ -3,15 +3,16 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"io"
 	"iter"
 	"os"
-	"os/signal"
-	"strconv"
+	"slices"
 	"time"
 )
 
-const MaxRetries = 5
+const MaxRetries = 5 // default, see RetryPolicy
 // The following two values are used to simulate buffering
 const RatelimitDelay = 2.0      // in Seconds; How long to delay the next chunk download.
 const RatelimitDelayAfter = 5.0 // in Seconds; Delay the next chunk download after this duration.
@@ -26,156 +27,506 @@ type DownloadProgress struct {
 	Retries int
 	Title string
 	Waiting bool
+	Remuxing bool
+	// The stream is still running, new chunks are added to the download
+	// until it ends or the download is stopped
+	Live bool
+	// Chunks that failed the integrity check and were downloaded again
+	InvalidChunks int
+	// Chunks of a live stream that were gone before they could be downloaded
+	MissedChunks int
+	// The last reload of the live playlist failed, it is tried again until
+	// LiveTimeout
+	ReloadError error
+	// The first chunk of a precise cut has no keyframe before the start,
+	// its video starts at the beginning of the chunk
+	ImpreciseStart bool
+	// Bytes written into the output and the estimated size of the
+	// complete output (0 if unknown)
+	BytesWritten  int64
+	EstimatedSize int64
+	ChunksDone    int
+	ChunksTotal   int
+	// The remaining time including the simulated buffering, -1 if unknown
+	Eta time.Duration
+	// in Bytes/s since the download was (re)started, including the
+	// simulated buffering; Rate is the current rate
+	AverageRate float64
+	// The timestamp in the stream up to which the video is downloaded
+	// and the chapter at that timestamp (nil if there are no chapters)
+	Position time.Duration
+	Chapter  *StreamEpChapter
 }
 
-func (ep *StreamEpisode) DownloadStreamEpisode(
-	chapter *StreamEpChapter,
-	formatName string,
-	outputFile string,
-	overwrite bool,
-	continueDl bool,
-	startOffset time.Duration,
-	stopOffset time.Duration,
-	ratelimit float64,
-	interruptChan chan os.Signal,
-) iter.Seq[DownloadProgress] {
+type DownloadOptions struct {
+	Chapter     *StreamEpChapter
+	FormatName  string
+	OutputFile  string
+	Overwrite   bool
+	ContinueDl  bool
+	StartOffset time.Duration
+	StopOffset  time.Duration
+	Ratelimit   float64 // in Bytes/s, unlimited if <= 0; only used if RateLimiter is nil
+	RateLimiter *RateLimiter
+	RetryPolicy RetryPolicy // DefaultRetryPolicy if MaxAttempts is 0
+	Connections int
+	// Write directly into OutputFile instead of <OutputFile>.part
+	NoPartFile bool
+	// Trim the first and last chunk to the exact start and stop offsets
+	PreciseCut bool
+	// Don't check the integrity of downloaded chunks, see validateTsChunk()
+	NoValidation bool
+	// Optional, the uncut chunk list of the format, so it doesn't have to
+	// be fetched again for every download
+	ChunkList *ChunkList
+	// Optional, can be shared between downloads of the same format
+	ChunkCache *ChunkCache
+	// ContainerTs (default), ContainerMkv, ContainerMp4 or the audio-only
+	// ContainerAac and ContainerM4a. Fragmented MP4 files are written
+	// while downloading, for Matroska the transport stream is downloaded
+	// into <OutputFile>.ts.part and remuxed when the download is finished.
+	Container string
+	// Optional, where the download is written into. By default, this is
+	// a FileSink for OutputFile, which also uses NoPartFile.
+	Sink Sink
+	// The file to save the download state into, so the download can be
+	// continued. Defaults to <OutputFile>.dl-info if Sink is nil,
+	// otherwise no state is saved.
+	StateFile string
+	// LayoutFile (default) or LayoutHls, which can't be combined with
+	// Sink. With LayoutHls, OutputFile is the directory of an HLS mirror,
+	// see HlsSink.
+	Layout string
+}
+
+// Download the episode. The download stops when ctx is cancelled, in
+// which case an Aborted progress event is yielded and the download can
+// be continued later. Episodes that are still being streamed are
+// followed until the stream ends; cancelling ctx finishes such a
+// download with the chunks that were written so far, it can't be
+// continued or cut.
+func (ep *StreamEpisode) DownloadStreamEpisode(ctx context.Context, opts DownloadOptions) iter.Seq[DownloadProgress] {
 	return func (yield func(DownloadProgress) bool) {
 		// Set automatic values
-		if outputFile == "" {
-			outputFile = ep.ProposeFilename(chapter)
+		if opts.Container == "" {
+			opts.Container = ContainerTs
+		} else if !slices.Contains(Containers, opts.Container) {
+			yield(DownloadProgress{Error: &ContainerUnsupportedError{Container: opts.Container}})
+			return
+		}
+		if opts.Layout == "" {
+			opts.Layout = LayoutFile
+		} else if !slices.Contains(Layouts, opts.Layout) {
+			yield(DownloadProgress{Error: &LayoutUnsupportedError{Layout: opts.Layout}})
+			return
+		} else if opts.Layout == LayoutHls && opts.Container != ContainerTs {
+			yield(DownloadProgress{Error: &LayoutContainerError{Layout: opts.Layout, Container: opts.Container}})
+			return
+		} else if opts.Layout == LayoutHls && opts.PreciseCut {
+			// the chunks of the mirror are the original ones
+			yield(DownloadProgress{Error: &LayoutPreciseCutError{Layout: opts.Layout}})
+			return
+		} else if opts.Layout == LayoutHls && opts.Sink != nil {
+			yield(DownloadProgress{Error: &LayoutSinkError{Layout: opts.Layout}})
+			return
+		}
+		if opts.OutputFile == "" && opts.Layout == LayoutHls {
+			opts.OutputFile = HlsMirrorDir(ep.ProposeFilename(opts.Chapter))
+		} else if opts.OutputFile == "" {
+			opts.OutputFile = ContainerFilename(ep.ProposeFilename(opts.Chapter), opts.Container)
 		}
-		if chapter != nil {
-			if startOffset < 0 {
-				startOffset = time.Duration(ep.Chapters[chapter.Index].StartOffset)
+		if opts.Chapter != nil {
+			if opts.StartOffset < 0 {
+				opts.StartOffset = time.Duration(ep.Chapters[opts.Chapter.Index].StartOffset)
 			}
-			if stopOffset < 0 {
+			if opts.StopOffset < 0 {
 				// next chapter is stop
-				stopOffset = time.Duration(ep.Chapters[chapter.Index].EndOffset)
+				opts.StopOffset = time.Duration(ep.Chapters[opts.Chapter.Index].EndOffset)
 			}
 		}
 		//
-		var err error
-		var nextChunk int = 0
-		var videoFile *os.File
-		var infoFile *os.File
-		var infoFilename string
-		if !overwrite && !continueDl {
-			if _, err := os.Stat(outputFile); err == nil {
-				yield(DownloadProgress{Error: &FileExistsError{Filename: outputFile}})
+		format, err := ep.FormatByName(opts.FormatName)
+		if err != nil {
+			yield(DownloadProgress{Error: err})
+			return
+		}
+		policy := opts.RetryPolicy.orDefault()
+		var chunklist ChunkList
+		if opts.ChunkList != nil {
+			chunklist = *opts.ChunkList
+		} else {
+			chunklist, err = format.StreamChunkList(ctx, policy)
+			if ctx.Err() != nil {
+				yield(DownloadProgress{Aborted: true})
+				return
+			} else if err != nil {
+				yield(DownloadProgress{Error: err})
 				return
 			}
 		}
-		videoFile, err = os.OpenFile(outputFile, os.O_RDWR|os.O_CREATE, 0660)
-		if err != nil {
-			yield(DownloadProgress{Error: err})
+		chunklist = chunklist.Cut(opts.StartOffset, opts.StopOffset)
+		if chunklist.Live {
+			if opts.ContinueDl && !opts.Overwrite {
+				yield(DownloadProgress{Error: &LiveDownloadError{Msg: "the stream is still running, the download can't be continued"}})
+				return
+			} else if opts.StartOffset >= 0 || opts.StopOffset >= 0 {
+				// the chunks of a sliding window don't start at the start of the stream
+				yield(DownloadProgress{Error: &LiveDownloadError{Msg: "chapters and start or stop timestamps are not supported while the stream is running"}})
+				return
+			}
+			// new chunks are appended, the list may share its array with opts.ChunkList
+			chunklist.Chunks = slices.Clip(chunklist.Chunks)
+		}
+		//
+		sink := opts.Sink
+		var fileSink *FileSink
+		infoFilename := opts.StateFile
+		remux := opts.Container == ContainerMkv
+		if sink == nil && opts.Layout == LayoutHls {
+			hlsSink := NewHlsSink(opts.OutputFile, format.Name, &chunklist, opts.Overwrite)
+			sink = hlsSink
+			if infoFilename == "" {
+				infoFilename = hlsSink.PlaylistFilename() + ".dl-info"
+			}
+		} else if sink == nil {
+			fileSink = NewFileSink(opts.OutputFile, opts.NoPartFile, opts.Overwrite)
+			if remux {
+				// Matroska files are remuxed from a .ts.part file at the end
+				fileSink.remux = opts.Container
+			}
+			sink = fileSink
+			if infoFilename == "" {
+				infoFilename = opts.OutputFile + ".dl-info"
+			}
+		} else if remux {
+			yield(DownloadProgress{Error: &SinkContainerError{Container: opts.Container}})
 			return
 		}
-		defer videoFile.Close()
-		if overwrite {
-			videoFile.Truncate(0)
+		if chunklist.Live {
+			infoFilename = ""
+		}
+		saveState := func(state *DownloadState) error {
+			if infoFilename == "" {
+				return nil
+			}
+			return writeDownloadState(infoFilename, state)
 		}
-		// always seek to the end
-		videoFile.Seek(0, io.SeekEnd)
 		// info file
-		infoFilename = outputFile + ".dl-info"
-		if continueDl {
-			infoFileData, err := os.ReadFile(infoFilename)
-			if err != nil {
-				yield(DownloadProgress{Error: &DownloadInfoFileReadError{}})
+		state := newDownloadState(ep, &format, &chunklist, &opts)
+		if opts.ContinueDl && !opts.Overwrite {
+			if infoFilename == "" {
+				yield(DownloadProgress{Error: &SinkNotResumableError{}})
 				return
 			}
-			i, err := strconv.ParseInt(string(infoFileData), 10, 32)
-			nextChunk = int(i)
+			expected := state
+			state, err = readDownloadState(infoFilename)
+			if err == nil {
+				err = state.validate(&expected)
+			}
 			if err != nil {
 				yield(DownloadProgress{Error: err})
 				return
 			}
 		}
-		infoFile, err = os.OpenFile(infoFilename, os.O_RDWR|os.O_CREATE, 0660)
-		if err != nil {
-			yield(DownloadProgress{Error: err})
-			return
+		offset := state.CommittedSize
+		if state.Migrated && state.CommittedSize == 0 {
+			// the old format doesn't record the size, so we have to trust the output
+			offset = -1
 		}
-		infoFile.Truncate(0)
-		infoFile.Seek(0, io.SeekStart)
-		_, err = infoFile.Write([]byte(strconv.Itoa(nextChunk)))
-		if err != nil {
-			yield(DownloadProgress{Error: err})
-			return
+		state.CommittedSize, err = sink.Open(offset)
+		if err == nil {
+			err = saveState(&state)
 		}
-		// download
-		format, _ := ep.FormatByName(formatName) // we don't have to check the error, as it was already checked by CliRun()
-		chunklist, err := format.StreamChunkList()
-		chunklist = chunklist.Cut(startOffset, stopOffset)
 		if err != nil {
+			sink.Close(false)
 			yield(DownloadProgress{Error: err})
 			return
 		}
-		var bufferDt float64
+		complete := false
+		defer func() {
+			if !complete {
+				sink.Close(false)
+			}
+		}()
+		nextChunk := state.NextChunk
 		var progress float32
 		var actualRate float64
-		keyboardInterrupt := false
-		signal.Notify(interruptChan, os.Interrupt)
-		go func() {
-			// Handle Interrupts
-			<-interruptChan
-			keyboardInterrupt = true
-			yield(DownloadProgress{Aborted: true, Progress: progress, Rate: actualRate, Retries: 0, Title: ep.Title})
-		}()
-		for i, chunk := range chunklist.Chunks {
-			if i < nextChunk { continue }
-			var time1 int64
-			var data []byte
-			retries := 0
-			for {
-				if keyboardInterrupt { break }
-				time1 = time.Now().UnixNano()
-				if !yield(DownloadProgress{Progress: progress, Rate: actualRate, Delaying: false, Waiting: true, Retries: retries, Title: ep.Title}) { return }
-				data, err = httpGet(chunklist.BaseUrl+"/"+chunk, ApiHeadersVideoAdditional, time.Second*5)
-				if err != nil {
-					if retries == MaxRetries {
-						yield(DownloadProgress{Error: err})
-						return
+		invalidChunks := 0
+		impreciseStart := false
+		missedChunks := 0
+		// start workers
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		connections := max(opts.Connections, 1)
+		limiter := opts.RateLimiter
+		if limiter == nil {
+			limiter = NewRateLimiter(opts.Ratelimit, RatelimitBurst)
+		}
+		jobs := make(chan chunkJob)
+		results := make(chan chunkResult)
+		keys := newChunkKeys()
+		for range connections {
+			go chunkWorker(ctx, policy, limiter, opts.ChunkCache, keys, !opts.NoValidation, jobs, results)
+		}
+		var live *livePlaylist
+		if chunklist.Live {
+			live = newLivePlaylist(format.Url, policy, &chunklist)
+		}
+		var chapters []mp4Chapter
+		if opts.Container == ContainerM4a {
+			chapters = downloadChapters(ep, &chunklist, &opts)
+		}
+		tracker := newProgressTracker(ep, &chunklist, &format, nextChunk)
+		report := func(p DownloadProgress) bool {
+			p.Progress, p.Rate, p.Title, p.InvalidChunks, p.MissedChunks = progress, actualRate, ep.Title, invalidChunks, missedChunks
+			p.ImpreciseStart = impreciseStart
+			if live != nil {
+				p.ReloadError = live.reloadErr
+			}
+			tracker.fill(&p, &state)
+			return yield(p)
+		}
+		aborted := func() {
+			report(DownloadProgress{Aborted: true})
+		}
+		pending := map[int]chunkResult{}
+		nextDispatch := nextChunk
+		inFlight := 0
+		bufferStart := time.Now()
+		rateStart := time.Now()
+		var rateBytes int
+	chunks:
+		for nextChunk < len(chunklist.Chunks) || chunklist.Live {
+			if ctx.Err() != nil && live != nil {
+				break
+			} else if ctx.Err() != nil {
+				aborted()
+				return
+			}
+			if nextChunk == len(chunklist.Chunks) {
+				// everything is written, wait for new chunks of the live stream
+				if !report(DownloadProgress{Waiting: true}) { return }
+				update, missed, err := live.next(ctx)
+				if ctx.Err() != nil {
+					continue
+				} else if err != nil {
+					yield(DownloadProgress{Error: err})
+					return
+				}
+				missedChunks += missed
+				chunklist.extend(&update)
+				continue
+			}
+			// keep up to <connections> chunks ahead of the writer
+			for inFlight < connections && nextDispatch < len(chunklist.Chunks) && nextDispatch < nextChunk+connections {
+				jobs <- chunkJob{index: nextDispatch, chunk: chunklist.Chunks[nextDispatch]}
+				nextDispatch++
+				inFlight++
+			}
+			if _, ok := pending[nextChunk]; !ok {
+				if !report(DownloadProgress{Waiting: true}) { return }
+				var r chunkResult
+				select {
+				case r = <-results:
+				case <-ctx.Done():
+					if live != nil {
+						break chunks
+					}
+					aborted()
+					return
+				}
+				if r.err != nil {
+					yield(DownloadProgress{Error: r.err})
+					return
+				}
+				if !r.done {
+					if r.invalid {
+						invalidChunks++
 					}
-					retries++
+					if !report(DownloadProgress{Waiting: true, Retries: r.retries}) { return }
 					continue
 				}
-				break
+				tracker.downloaded(len(r.data))
+				inFlight--
+				pending[r.index] = r
+				continue
 			}
-			if keyboardInterrupt { break }
-			var dtDownload float64 = float64(time.Now().UnixNano()-time1) / 1000000000.0
-			rate := float64(len(data)) / dtDownload
-			actualRate = rate - max(rate-ratelimit, 0)
-			progress = float32(i+1) / float32(len(chunklist.Chunks))
-			delayNow := bufferDt > RatelimitDelayAfter
-			if !yield(DownloadProgress{Progress: progress, Rate: actualRate, Delaying: delayNow, Waiting: false, Retries: retries, Title: ep.Title}) { return }
+			// write chunks in playlist order
+			r := pending[nextChunk]
+			delete(pending, nextChunk)
+			rateBytes += len(r.data)
+			progress = float32(nextChunk+1) / float32(len(chunklist.Chunks))
+			delayNow := time.Since(bufferStart).Seconds() > RatelimitDelayAfter
 			if delayNow {
-				bufferDt = 0
+				if !report(DownloadProgress{Delaying: true, Retries: r.retries}) { return }
 				// this simulates that the buffering is finished and the player is playing
-				time.Sleep(time.Duration(RatelimitDelay * float64(time.Second)))
-			} else if rate > ratelimit {
-				// slow down, we are too fast.
-				deferTime := (rate - ratelimit) / ratelimit * dtDownload
-				time.Sleep(time.Duration(deferTime * float64(time.Second)))
+				delay := time.Duration(RatelimitDelay * float64(time.Second))
+				if !sleepCtx(ctx, delay) && live != nil {
+					break
+				} else if ctx.Err() != nil {
+					aborted()
+					return
+				}
+				tracker.delayed += delay
+				bufferStart = time.Now()
+				rateStart = bufferStart
+				rateBytes = 0
+			} else {
+				actualRate = float64(rateBytes) / time.Since(rateStart).Seconds()
+				if !report(DownloadProgress{Retries: r.retries}) { return }
+			}
+			data := r.data
+			if opts.PreciseCut {
+				var imprecise bool
+				data, imprecise, err = trimChunkAt(&chunklist, nextChunk, data, opts.StartOffset, opts.StopOffset)
+				if err != nil {
+					yield(DownloadProgress{Error: err})
+					return
+				}
+				impreciseStart = impreciseStart || imprecise
+			}
+			if opts.Container == ContainerAac {
+				data, err = tsToAdts(data)
+				if err != nil {
+					yield(DownloadProgress{Error: err})
+					return
+				}
+			}
+			if state.Mp4 != nil {
+				muxer := fmp4Muxer{state: state.Mp4, chapters: chapters}
+				data, err = muxer.fragment(data, state.CommittedSize)
+				if err != nil {
+					yield(DownloadProgress{Error: err})
+					return
+				}
+			}
+			// data first, then the info file
+			err = sink.WriteChunk(chunklist.Chunks[nextChunk], data)
+			if err == nil {
+				err = sink.Commit()
+			}
+			if err == nil {
+				state.commitChunk(int64(len(data)))
+				err = saveState(&state)
+			}
+			if err != nil {
+				yield(DownloadProgress{Error: err})
+				return
 			}
-			videoFile.Write(data)
 			nextChunk++
-			infoFile.Truncate(0)
-			infoFile.Seek(0, io.SeekStart)
-			infoFile.Write([]byte(strconv.Itoa(nextChunk)))
-			var dtIteration float64 = float64(time.Now().UnixNano()-time1) / 1000000000.0
-			if !delayNow {
-				bufferDt += dtIteration
+		}
+		if live != nil && ctx.Err() != nil {
+			// the download was stopped, finish the output anyways
+			ctx = context.WithoutCancel(ctx)
+		}
+		if w, ok := sink.(io.WriterAt); ok && state.Mp4 != nil {
+			err = finishFmp4(w, state.Mp4)
+			if err == nil {
+				err = sink.Commit()
+			}
+			if err != nil {
+				yield(DownloadProgress{Progress: progress, Rate: actualRate, Error: err})
+				return
 			}
 		}
-		infoFile.Close()
-		if !keyboardInterrupt {
-			err := os.Remove(infoFilename)
+		if remux {
+			if !report(DownloadProgress{Remuxing: true}) { return }
+			err = fileSink.remuxOutput(ctx)
+			if ctx.Err() != nil {
+				aborted()
+				return
+			}
 			if err != nil {
 				yield(DownloadProgress{Progress: progress, Rate: actualRate, Error: err})
 				return
 			}
 		}
-		yield(DownloadProgress{Progress: progress, Rate: actualRate, Success: true})
+		complete = true
+		err = sink.Close(true)
+		if err == nil && infoFilename != "" {
+			err = os.Remove(infoFilename)
+		}
+		if err != nil {
+			yield(DownloadProgress{Progress: progress, Rate: actualRate, Error: err})
+			return
+		}
+		report(DownloadProgress{Success: true})
+	}
+}
+
+type chunkJob struct {
+	index int
+	chunk Chunk // a copy, the chunk list of a live stream grows
+}
+
+type chunkResult struct {
+	index   int
+	data    []byte
+	err     error
+	retries int
+	done    bool // false if this is only a retry notification
+	invalid bool // the retry is because of a failed integrity check
+}
+
+func chunkWorker(ctx context.Context, policy RetryPolicy, limiter *RateLimiter, cache *ChunkCache, keys *chunkKeys, validate bool, jobs <-chan chunkJob, results chan<- chunkResult) {
+	send := func(r chunkResult) bool {
+		select {
+		case results <- r:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		var job chunkJob
+		select {
+		case job = <-jobs:
+		case <-ctx.Done():
+			return
+		}
+		i, url := job.index, job.chunk.Url
+		if cache != nil {
+			if data, ok := cache.Get(url); ok {
+				if !send(chunkResult{index: i, data: data, done: true}) { return }
+				continue
+			}
+		}
+		retries := 0
+		var data []byte
+		err := policy.do(ctx, func() error {
+			var err error
+			data, err = httpGet(ctx, url, ApiHeadersVideoAdditional, time.Second*5, limiter)
+			if err == nil {
+				data, err = keys.decrypt(ctx, &job.chunk, data)
+			}
+			if err == nil && validate {
+				err = validateTsChunk(url, data)
+			}
+			return err
+		}, func(retry int, err error) {
+			retries = retry
+			var validationErr *ChunkValidationError
+			send(chunkResult{index: i, retries: retries, invalid: errors.As(err, &validationErr)})
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil && cache != nil {
+			cache.Put(url, data)
+		}
+		if !send(chunkResult{index: i, data: data, err: err, retries: retries, done: true}) || err != nil {
+			return
+		}
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
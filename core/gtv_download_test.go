@@ -0,0 +1,61 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadOptionErrors(t *testing.T) {
+	ep := StreamEpisode{Title: "test", Formats: []VideoFormat{{Name: "720p", Url: "http://127.0.0.1:0/720p.m3u8"}}}
+	tests := []struct {
+		name   string
+		modify func(opts *DownloadOptions)
+		target any
+	}{
+		{"container", func(opts *DownloadOptions) { opts.Container = "avi" }, new(*ContainerUnsupportedError)},
+		{"layout", func(opts *DownloadOptions) { opts.Layout = "dir" }, new(*LayoutUnsupportedError)},
+		{"layout and container", func(opts *DownloadOptions) {
+			opts.Layout, opts.Container = LayoutHls, ContainerMp4
+		}, new(*LayoutContainerError)},
+		{"layout and precise cut", func(opts *DownloadOptions) {
+			opts.Layout, opts.PreciseCut = LayoutHls, true
+		}, new(*LayoutPreciseCutError)},
+		{"layout and sink", func(opts *DownloadOptions) {
+			opts.Layout, opts.Sink = LayoutHls, &WriterSink{Writer: io.Discard}
+		}, new(*LayoutSinkError)},
+		{"format", func(opts *DownloadOptions) { opts.FormatName = "1080p60" }, new(*FormatNotFoundError)},
+		{"format expression", func(opts *DownloadOptions) { opts.FormatName = "bw<" }, new(*FormatExpressionError)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := DownloadOptions{
+				FormatName:  "720p",
+				OutputFile:  filepath.Join(dir, "test"),
+				StartOffset: -1,
+				StopOffset:  -1,
+			}
+			tt.modify(&opts)
+			n := 0
+			for p := range ep.DownloadStreamEpisode(context.Background(), opts) {
+				n++
+				if !errors.As(p.Error, tt.target) {
+					t.Errorf("expected a %T, got %+v", tt.target, p)
+				}
+			}
+			if n != 1 {
+				t.Errorf("%v progress events instead of 1", n)
+			}
+			// nothing was written
+			if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+				t.Errorf("%v files were created", len(entries))
+			}
+		})
+	}
+}
@@ -1,21 +1,75 @@
 package core
 
 import (
+	"context"
 	"strings"
 	"time"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core/m3u8"
+)
+
+const (
+	VideoCodecH264 = "h264"
+	VideoCodecHevc = "hevc"
 )
 
 type VideoFormat struct {
-	Name string `json:"format"`
-	Url  string `json:"url"`
+	Name      string  `json:"format"`
+	Url       string  `json:"url"`
+	Bandwidth int     `json:"bandwidth"` // in Bits/s, 0 if unknown
+	Width     int     `json:"width"`     // 0 if unknown
+	Height    int     `json:"height"`
+	FrameRate float64 `json:"frame_rate"`
+	Codecs    string  `json:"codecs"` // the CODECS attribute of the playlist
+	Codec     string  `json:"codec"`  // VideoCodecH264 or VideoCodecHevc
+}
+
+func (vf *VideoFormat) IsHevc() bool {
+	return vf.Codec == VideoCodecHevc
+}
+
+// HEVC formats are recognized by their codecs (hvc1 or hev1) or their name
+func videoCodec(name string, codecs string) string {
+	codecs = strings.ToLower(codecs)
+	if strings.Contains(codecs, "hvc1") || strings.Contains(codecs, "hev1") || strings.Contains(strings.ToLower(name), "hevc") {
+		return VideoCodecHevc
+	}
+	return VideoCodecH264
 }
 
-func (vf *VideoFormat) StreamChunkList() (ChunkList, error) {
-	baseUrl := vf.Url[:strings.LastIndex(vf.Url, "/")]
-	data, err := httpGet(vf.Url, ApiHeadersMetaAdditional, time.Second*10)
+// The request is retried according to policy, DefaultRetryPolicy if
+// MaxAttempts is 0
+func (vf *VideoFormat) StreamChunkList(ctx context.Context, policy RetryPolicy) (ChunkList, error) {
+	data, err := httpGetRetry(ctx, policy.orDefault(), vf.Url, ApiHeadersMetaAdditional, time.Second*10, nil)
+	if err != nil {
+		return ChunkList{}, err
+	}
+	playlist, err := m3u8.ParseMedia(data, vf.Url)
 	if err != nil {
 		return ChunkList{}, err
 	}
-	chunklist, err := parseChunkListFromM3u8(string(data), baseUrl)
-	return chunklist, err
+	return chunkListFromPlaylist(playlist)
+}
+
+// The video formats of a master playlist, the variants with a resolution
+// and a NAME attribute
+func videoFormatsFromPlaylist(pl *m3u8.MasterPlaylist) []VideoFormat {
+	formats := []VideoFormat{}
+	for _, v := range pl.Variants {
+		name, err := v.Attributes.QuotedString("NAME")
+		if err != nil || v.Resolution.Height == 0 {
+			continue
+		}
+		formats = append(formats, VideoFormat{
+			Name:      name,
+			Url:       v.Uri,
+			Bandwidth: int(v.Bandwidth),
+			Width:     v.Resolution.Width,
+			Height:    v.Resolution.Height,
+			FrameRate: v.FrameRate,
+			Codecs:    v.Codecs,
+			Codec:     videoCodec(name, v.Codecs),
+		})
+	}
+	return formats
 }
@@ -0,0 +1,141 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core/m3u8"
+)
+
+// The current live stream of the channel. This endpoint isn't documented,
+// the response is expected to look like the one of an episode, with an
+// empty playlist url if the channel is offline.
+const ApiUrlLiveInfo = "https://backend.gronkh.tv/v1/live/info"
+
+// Stop following a live playlist that didn't get new chunks for this long
+const LiveTimeout = 5 * time.Minute
+
+func liveStreamEpisode(ctx context.Context, infoUrl string, policy RetryPolicy) (StreamEpisode, error) {
+	info_data, err := httpGetRetry(
+		ctx,
+		policy,
+		infoUrl,
+		ApiHeadersMetaAdditional,
+		time.Second*10,
+		nil,
+	)
+	if err != nil {
+		return StreamEpisode{}, err
+	}
+	epContainer := ResponseStreamEpisode{}
+	json.Unmarshal(info_data, &epContainer)
+	ep := epContainer.StreamEpisode
+	if ep.Urls.Playlist == "" {
+		return ep, &LiveStreamOfflineError{}
+	}
+	ep.Live = true
+	ep.Title = strings.ToValidUTF8(ep.Title, "")
+	if ep.Title == "" {
+		ep.Title = "Live"
+	}
+	// the chapters of a running stream are incomplete
+	ep.Chapters = nil
+	err = ep.fetchFormats(ctx, policy)
+	return ep, err
+}
+
+// Follows the media playlist of a live stream or an episode that is still
+// being streamed
+type livePlaylist struct {
+	url     string
+	policy  RetryPolicy
+	target  time.Duration
+	lastSeq int64         // the sequence number of the last known chunk
+	end     time.Duration // the end of the last known chunk
+	loaded  time.Time     // the last reload
+	changed time.Time     // the last reload with new chunks
+	// The error of the last reload, nil if it succeeded
+	reloadErr error
+}
+
+func newLivePlaylist(url string, policy RetryPolicy, chunklist *ChunkList) *livePlaylist {
+	now := time.Now()
+	l := &livePlaylist{
+		url:     url,
+		policy:  policy,
+		target:  max(time.Duration(chunklist.ChunkDuration*float64(time.Second)), time.Second),
+		lastSeq: -1,
+		loaded:  now,
+		changed: now,
+	}
+	if len(chunklist.Chunks) > 0 {
+		last := chunklist.Chunks[len(chunklist.Chunks)-1]
+		l.lastSeq, l.end = last.SequenceNumber, last.Start+last.Duration
+	}
+	return l
+}
+
+// Wait until the playlist should be reloaded (RFC 8216, 6.3.4) and return
+// the chunks that were added since the last reload and the number of
+// chunks that were removed from the playlist before they could be seen.
+// Failed reloads are treated like reloads without new chunks and kept in
+// reloadErr, unless the error is permanent. The returned list isn't Live
+// anymore after the EXT-X-ENDLIST tag or LiveTimeout without new chunks.
+func (l *livePlaylist) next(ctx context.Context) (ChunkList, int, error) {
+	update := ChunkList{ChunkDuration: l.target.Seconds(), Live: true}
+	interval := l.target
+	if l.changed.Before(l.loaded) {
+		interval /= 2
+	}
+	if !sleepCtx(ctx, time.Until(l.loaded.Add(interval))) {
+		return update, 0, ctx.Err()
+	}
+	data, err := httpGetRetry(ctx, l.policy, l.url, ApiHeadersMetaAdditional, time.Second*10, nil)
+	l.loaded = time.Now()
+	if ctx.Err() != nil {
+		return update, 0, ctx.Err()
+	}
+	l.reloadErr = err
+	if err != nil && isPermanentError(err) {
+		// e.g. the playlist was removed
+		return update, 0, err
+	}
+	missed := 0
+	if err == nil {
+		var playlist *m3u8.MediaPlaylist
+		playlist, err = m3u8.ParseMedia(data, l.url)
+		if err != nil {
+			return update, 0, err
+		}
+		reloaded, err := chunkListFromPlaylist(playlist)
+		if err != nil {
+			return update, 0, err
+		}
+		for _, c := range reloaded.Chunks {
+			if c.SequenceNumber <= l.lastSeq {
+				continue
+			}
+			if l.lastSeq >= 0 && c.SequenceNumber > l.lastSeq+1 {
+				// we don't know the durations of the missed chunks
+				gap := c.SequenceNumber - l.lastSeq - 1
+				missed += int(gap)
+				l.end += time.Duration(gap) * l.target
+			}
+			c.Start = l.end
+			l.end += c.Duration
+			l.lastSeq = c.SequenceNumber
+			update.Chunks = append(update.Chunks, c)
+		}
+		update.Live = reloaded.Live
+	}
+	if len(update.Chunks) > 0 {
+		l.changed = l.loaded
+	} else if time.Since(l.changed) > LiveTimeout {
+		update.Live = false
+	}
+	return update, missed, nil
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsLiveUrl(t *testing.T) {
+	tests := []struct {
+		url  string
+		live bool
+	}{
+		{"https://gronkh.tv/live", true},
+		{"https://gronkh.tv/live/", true},
+		{"gronkh.tv/live?autoplay=1", true},
+		{"https://gronkh.tv/live/123", false},
+		{"https://gronkh.tv/stream/777", false},
+		{"https://gronkh.tv/lively", false},
+	}
+	for _, tt := range tests {
+		if IsLiveUrl(tt.url) != tt.live {
+			t.Errorf("IsLiveUrl(%q) != %v", tt.url, tt.live)
+		}
+	}
+}
+
+// The response of the live info endpoint is mocked, the media playlist of
+// 720p grows with every request: chunks 0 and 1, then 1 and 2, then 4
+// with the end tag (3 is missed)
+func newLiveServer(t *testing.T, info string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	playlistRequests := &atomic.Int32{}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/live/info":
+			w.Write([]byte(strings.ReplaceAll(info, "$URL", srv.URL)))
+		case "/master.m3u8":
+			w.Write([]byte("#EXTM3U\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,NAME=\"1080p60\"\n1080p60.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,NAME=\"720p\"\n720p.m3u8\n"))
+		case "/720p.m3u8":
+			var sequence []int
+			switch playlistRequests.Add(1) {
+			case 1:
+				sequence = []int{0, 1}
+			case 2:
+				sequence = []int{1, 2}
+			default:
+				sequence = []int{4}
+			}
+			var b strings.Builder
+			fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:%v\n", sequence[0])
+			for _, n := range sequence {
+				fmt.Fprintf(&b, "#EXTINF:1,\nc%v.ts\n", n)
+			}
+			if len(sequence) == 1 {
+				b.WriteString("#EXT-X-ENDLIST\n")
+			}
+			w.Write([]byte(b.String()))
+		default:
+			var i int
+			if _, err := fmt.Sscanf(r.URL.Path, "/c%d.ts", &i); err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(bytes.Repeat([]byte{byte(i + 1)}, 100))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, playlistRequests
+}
+
+func TestLiveStreamEpisode(t *testing.T) {
+	srv, _ := newLiveServer(t, `{"data": {"title": "", "urls": {"playlist": "$URL/master.m3u8"}, "chapters": [{"start_offset": 0, "category": {"title": "Just Chatting"}}]}}`)
+	ep, err := liveStreamEpisode(context.Background(), srv.URL+"/v1/live/info", DefaultRetryPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ep.Live || ep.Title != "Live" || ep.Chapters != nil {
+		t.Errorf("live %v, title %q, chapters %v", ep.Live, ep.Title, ep.Chapters)
+	}
+	if len(ep.Formats) != 2 || ep.Formats[1].Name != "720p" || ep.Formats[1].Url != srv.URL+"/720p.m3u8" {
+		t.Errorf("formats %+v", ep.Formats)
+	}
+	if name := ep.ProposeFilename(nil); !strings.HasSuffix(name, " - Live.ts") {
+		t.Errorf("filename %v", name)
+	}
+}
+
+func TestLiveStreamEpisodeOffline(t *testing.T) {
+	srv, _ := newLiveServer(t, `{"data": {"title": "Offline", "urls": {"playlist": ""}}}`)
+	_, err := liveStreamEpisode(context.Background(), srv.URL+"/v1/live/info", DefaultRetryPolicy)
+	var offlineErr *LiveStreamOfflineError
+	if !errors.As(err, &offlineErr) {
+		t.Fatalf("expected a LiveStreamOfflineError, got %v", err)
+	}
+}
+
+func TestDownloadLiveStream(t *testing.T) {
+	srv, playlistRequests := newLiveServer(t, `{"data": {"title": "Stream", "urls": {"playlist": "$URL/master.m3u8"}}}`)
+	ep, err := liveStreamEpisode(context.Background(), srv.URL+"/v1/live/info", DefaultRetryPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(t.TempDir(), "live.ts")
+	opts := DownloadOptions{
+		FormatName:   "720p",
+		OutputFile:   output,
+		StartOffset:  -1,
+		StopOffset:   -1,
+		NoValidation: true, // the chunks are no transport streams
+		RetryPolicy:  RetryPolicy{MaxAttempts: 1},
+	}
+	var last DownloadProgress
+	for p := range ep.DownloadStreamEpisode(context.Background(), opts) {
+		if p.Error != nil {
+			t.Fatal(p.Error)
+		}
+		last = p
+	}
+	if !last.Success || last.MissedChunks != 1 {
+		t.Errorf("success %v, missed chunks %v", last.Success, last.MissedChunks)
+	}
+	if n := playlistRequests.Load(); n != 3 {
+		t.Errorf("the playlist was loaded %v times instead of 3", n)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []byte
+	for _, i := range []int{0, 1, 2, 4} {
+		expected = append(expected, bytes.Repeat([]byte{byte(i + 1)}, 100)...)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("the output (%v bytes) doesn't contain chunks 0, 1, 2 and 4", len(data))
+	}
+	if _, err := os.Stat(output + ".dl-info"); !os.IsNotExist(err) {
+		t.Errorf("a state file was left for a live download: %v", err)
+	}
+}
+
+func TestDownloadLiveStreamCut(t *testing.T) {
+	srv, _ := newLiveServer(t, `{"data": {"title": "Stream", "urls": {"playlist": "$URL/master.m3u8"}}}`)
+	ep, err := liveStreamEpisode(context.Background(), srv.URL+"/v1/live/info", DefaultRetryPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DownloadOptions{FormatName: "720p", OutputFile: filepath.Join(t.TempDir(), "live.ts"), StartOffset: 0, StopOffset: -1}
+	for p := range ep.DownloadStreamEpisode(context.Background(), opts) {
+		var liveErr *LiveDownloadError
+		if !errors.As(p.Error, &liveErr) {
+			t.Fatalf("expected a LiveDownloadError, got %+v", p)
+		}
+		return
+	}
+	t.Fatal("no progress")
+}
+
+// The second reload of the media playlist fails with status
+func testLiveReloadError(t *testing.T, status int) (DownloadProgress, []DownloadProgress) {
+	t.Helper()
+	playlistRequests := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/720p.m3u8" {
+			w.Write(bytes.Repeat([]byte{1}, 100))
+			return
+		}
+		switch playlistRequests.Add(1) {
+		case 1:
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXTINF:1,\nc0.ts\n"))
+		case 2:
+			w.WriteHeader(status)
+		default:
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXTINF:1,\nc0.ts\n#EXTINF:1,\nc1.ts\n#EXT-X-ENDLIST\n"))
+		}
+	}))
+	defer srv.Close()
+	ep := StreamEpisode{Id: "777", Title: "test", Formats: []VideoFormat{{Name: "720p", Url: srv.URL + "/720p.m3u8"}}}
+	opts := DownloadOptions{
+		FormatName:   "720p",
+		OutputFile:   filepath.Join(t.TempDir(), "live.ts"),
+		StartOffset:  -1,
+		StopOffset:   -1,
+		NoValidation: true,
+		RetryPolicy:  RetryPolicy{MaxAttempts: 1},
+	}
+	var failed []DownloadProgress
+	var last DownloadProgress
+	for p := range ep.DownloadStreamEpisode(context.Background(), opts) {
+		if p.ReloadError != nil {
+			failed = append(failed, p)
+		}
+		last = p
+	}
+	return last, failed
+}
+
+func TestDownloadLiveReloadError(t *testing.T) {
+	last, failed := testLiveReloadError(t, http.StatusServiceUnavailable)
+	if !last.Success {
+		t.Fatalf("the download didn't recover: %+v", last)
+	}
+	var statusErr *HttpStatusCodeError
+	if len(failed) == 0 || !errors.As(failed[0].ReloadError, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("the failed reload wasn't reported: %+v", failed)
+	}
+	if last.ReloadError != nil {
+		t.Errorf("the reload error is still reported after a successful reload: %v", last.ReloadError)
+	}
+}
+
+func TestDownloadLiveReloadPermanentError(t *testing.T) {
+	start := time.Now()
+	last, _ := testLiveReloadError(t, http.StatusNotFound)
+	var statusErr *HttpStatusCodeError
+	if !errors.As(last.Error, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %+v", last)
+	}
+	if d := time.Since(start); d > LiveTimeout/2 {
+		t.Errorf("the download failed after %v", d)
+	}
+}
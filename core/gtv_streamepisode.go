@@ -1,11 +1,14 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
 	"time"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core/m3u8"
 )
 
 const ApiBaseurlStreamEpisodeInfo   = "https://backend.gronkh.tv/v3/videos/episode/%s"
@@ -50,27 +53,12 @@ type StreamEpisode struct {
 	Tags          []StreamEpVideoTag `json:"tags"`
 	//
 	Formats       []VideoFormat      `json:"formats"`
+	Live          bool               `json:"live"` // the live stream of the channel
 }
 
+// Select a format by its name or a format expression, see SelectFormat()
 func (ep *StreamEpisode) FormatByName(formatName string) (VideoFormat, error) {
-	var idx int
-	var err error = nil
-	if formatName == "auto" {
-		// since gronkh.tv 0.2.2, the last format is the best
-		return ep.Formats[len(ep.Formats)-1], nil
-	} else {
-		formatFound := false
-		for i, f := range ep.Formats {
-			if f.Name == formatName {
-				idx = i
-				formatFound = true
-			}
-		}
-		if !formatFound {
-			err = &FormatNotFoundError{FormatName: formatName}
-		}
-		return ep.Formats[idx], err
-	}
+	return ep.SelectFormat(formatName, false)
 }
 
 func (ep *StreamEpisode) ChapterByNumber(number int) (*StreamEpChapter, error) {
@@ -85,21 +73,43 @@ func (ep *StreamEpisode) ChapterByNumber(number int) (*StreamEpChapter, error) {
 	return chapter, nil
 }
 
+// The chapter at a timestamp of the stream, nil if there is none
+func (ep *StreamEpisode) ChapterAt(t time.Duration) *StreamEpChapter {
+	for i := len(ep.Chapters) - 1; i >= 0; i-- {
+		if ep.Chapters[i].StartOffset <= t {
+			return &ep.Chapters[i]
+		}
+	}
+	return nil
+}
+
 func (ep *StreamEpisode) ProposeFilename(chapter *StreamEpChapter) string {
 	if chapter != nil {
 		return fmt.Sprintf("GTV%04d - %v. %s.ts", ep.EpisodeNumber, chapter.Index, sanitizeUnicodeFilename(ep.Chapters[chapter.Index].Category.Title))
+	} else if ep.Live {
+		// the channel streams daily, often with the same title
+		return fmt.Sprintf("%s - %s.ts", time.Now().Format(time.DateOnly), sanitizeUnicodeFilename(ep.Title))
 	} else {
 		return sanitizeUnicodeFilename(ep.Title) + ".ts"
 	}
 }
 
-func StreamEpisodeFromUrl(url string) (StreamEpisode, error) {
+// Metadata requests are retried according to policy, DefaultRetryPolicy
+// if MaxAttempts is 0
+func StreamEpisodeFromUrl(ctx context.Context, url string, policy RetryPolicy) (StreamEpisode, error) {
+	policy = policy.orDefault()
+	if IsLiveUrl(url) {
+		return liveStreamEpisode(ctx, ApiUrlLiveInfo, policy)
+	}
 	epNumber, err := ParseEpisodeNumberFromVideoUrl(url)
 	if err != nil { return StreamEpisode{}, err }
-	info_data, err := httpGet(
+	info_data, err := httpGetRetry(
+		ctx,
+		policy,
 		fmt.Sprintf(ApiBaseurlStreamEpisodeInfo, epNumber),
 		ApiHeadersMetaAdditional,
 		time.Second*10,
+		nil,
 	)
 	if err != nil { return StreamEpisode{}, err }
 	// Parse JSON Response
@@ -130,16 +140,22 @@ func StreamEpisodeFromUrl(url string) (StreamEpisode, error) {
 	}
 	ep.Chapters = chaptersProcessed
 	// Formats
-	playlist_data, err := httpGet(
+	err = ep.fetchFormats(ctx, policy)
+	return ep, err
+}
+
+func (ep *StreamEpisode) fetchFormats(ctx context.Context, policy RetryPolicy) error {
+	playlist_data, err := httpGetRetry(
+		ctx,
+		policy,
 		ep.Urls.Playlist,
 		ApiHeadersMetaAdditional,
 		time.Second*10,
+		nil,
 	)
-	formats := parseAvailFormatsFromM3u8(string(playlist_data))
-	for _, f := range formats {
-		if !strings.Contains(strings.ToLower(f.Name), "hevc") {
-			ep.Formats = append(ep.Formats, f)
-		}
-	}
-	return ep, err
+	if err != nil { return err }
+	playlist, err := m3u8.ParseMaster(playlist_data, ep.Urls.Playlist)
+	if err != nil { return err }
+	ep.Formats = videoFormatsFromPlaylist(playlist)
+	return nil
 }
@@ -2,7 +2,16 @@ package core
 
 import "regexp"
 
+// The url of an episode by its number
+const StreamEpisodeUrlTemplate = "https://gronkh.tv/stream/%s"
+
 var videoUrlRegex = regexp.MustCompile(`gronkh\.tv\/([a-z]+)\/([0-9]+)`)
+var liveUrlRegex = regexp.MustCompile(`gronkh\.tv\/live\/?(\?.*)?$`)
+
+// The live page of the channel, see StreamEpisodeFromUrl()
+func IsLiveUrl(url string) bool {
+	return liveUrlRegex.MatchString(url)
+}
 
 func ParseEpisodeNumberFromVideoUrl(url string) (string, error) {
 	match := videoUrlRegex.FindStringSubmatch(url)
@@ -0,0 +1,192 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import "encoding/binary"
+
+// Reads bits from a NAL unit payload (emulation prevention bytes removed)
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+func (r *bitReader) bit() uint {
+	if r.pos >= len(r.data)*8 {
+		r.pos++
+		return 0
+	}
+	b := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+	r.pos++
+	return uint(b)
+}
+
+func (r *bitReader) bits(n int) uint {
+	var v uint
+	for range n {
+		v = v<<1 | r.bit()
+	}
+	return v
+}
+
+// Unsigned Exp-Golomb code
+func (r *bitReader) ue() uint {
+	zeros := 0
+	for r.bit() == 0 && zeros < 32 {
+		zeros++
+	}
+	return (1<<zeros - 1) + r.bits(zeros)
+}
+
+// Signed Exp-Golomb code
+func (r *bitReader) se() int {
+	v := r.ue()
+	if v&1 == 1 {
+		return int(v+1) / 2
+	}
+	return -int(v / 2)
+}
+
+func (r *bitReader) overrun() bool {
+	return r.pos > len(r.data)*8
+}
+
+// Remove the emulation prevention bytes (00 00 03) from a NAL unit
+func nalUnitRbsp(nalu []byte) []byte {
+	rbsp := make([]byte, 0, len(nalu))
+	zeros := 0
+	for _, b := range nalu {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		rbsp = append(rbsp, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return rbsp
+}
+
+// Convert Annex B data to NAL units with a 4 byte length prefix, as used
+// by Matroska and MP4. Access unit delimiters are dropped.
+func annexBToLengthPrefixed(data []byte, isDelimiter func(nalu []byte) bool) []byte {
+	out := make([]byte, 0, len(data)+16)
+	for nalu := range annexBNalUnits(data) {
+		if len(nalu) == 0 || isDelimiter(nalu) {
+			continue
+		}
+		out = binary.BigEndian.AppendUint32(out, uint32(len(nalu)))
+		out = append(out, nalu...)
+	}
+	return out
+}
+
+func isH264Delimiter(nalu []byte) bool {
+	return nalu[0]&0x1f == h264NalAud
+}
+
+type h264Sps struct {
+	width  int
+	height int
+}
+
+func parseH264Sps(nalu []byte) (h264Sps, error) {
+	sps := h264Sps{}
+	if len(nalu) < 4 {
+		return sps, &TsParseError{Msg: "H.264 SPS too short"}
+	}
+	r := &bitReader{data: nalUnitRbsp(nalu[1:])}
+	profile := r.bits(8)
+	r.bits(16) // constraint flags, level
+	r.ue()     // seq_parameter_set_id
+	chromaFormat := uint(1)
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat = r.ue()
+		if chromaFormat == 3 {
+			r.bit() // separate_colour_plane_flag
+		}
+		r.ue()  // bit_depth_luma_minus8
+		r.ue()  // bit_depth_chroma_minus8
+		r.bit() // qpprime_y_zero_transform_bypass_flag
+		if r.bit() == 1 {
+			// seq_scaling_matrix_present_flag
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := range lists {
+				if r.bit() == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := 8, 8
+				for range size {
+					if next != 0 {
+						next = (last + r.se() + 256) % 256
+					}
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+	r.ue() // log2_max_frame_num_minus4
+	switch r.ue() {
+	// pic_order_cnt_type
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bit() // delta_pic_order_always_zero_flag
+		r.se()  // offset_for_non_ref_pic
+		r.se()  // offset_for_top_to_bottom_field
+		n := r.ue()
+		for range min(n, 256) {
+			r.se()
+		}
+	}
+	r.ue()  // max_num_ref_frames
+	r.bit() // gaps_in_frame_num_value_allowed_flag
+	widthMbs := int(r.ue()) + 1
+	heightMapUnits := int(r.ue()) + 1
+	frameMbsOnly := int(r.bit())
+	if frameMbsOnly == 0 {
+		r.bit() // mb_adaptive_frame_field_flag
+	}
+	r.bit() // direct_8x8_inference_flag
+	sps.width = widthMbs * 16
+	sps.height = (2 - frameMbsOnly) * heightMapUnits * 16
+	if r.bit() == 1 {
+		// frame cropping
+		cropUnitX, cropUnitY := 1, 2-frameMbsOnly
+		switch chromaFormat {
+		case 1:
+			cropUnitX, cropUnitY = 2, 2*(2-frameMbsOnly)
+		case 2:
+			cropUnitX = 2
+		}
+		left, right, top, bottom := int(r.ue()), int(r.ue()), int(r.ue()), int(r.ue())
+		sps.width -= cropUnitX * (left + right)
+		sps.height -= cropUnitY * (top + bottom)
+	}
+	if r.overrun() || sps.width <= 0 || sps.height <= 0 {
+		return sps, &TsParseError{Msg: "invalid H.264 SPS"}
+	}
+	return sps, nil
+}
+
+// AVCDecoderConfigurationRecord (ISO/IEC 14496-15)
+func avcDecoderConfig(sps []byte, pps []byte) []byte {
+	b := []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(sps)))
+	b = append(b, sps...)
+	b = append(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(pps)))
+	return append(b, pps...)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import "encoding/binary"
+
+// H.265 NAL unit types
+const (
+	hevcNalIrapFirst = 16 // BLA_W_LP, the first IRAP (keyframe) type
+	hevcNalIrapLast  = 21 // CRA_NUT, the last IRAP type
+	hevcNalVps       = 32
+	hevcNalSps       = 33
+	hevcNalPps       = 34
+	hevcNalAud       = 35
+)
+
+func hevcNalType(nalu []byte) byte {
+	return nalu[0] >> 1 & 0x3f
+}
+
+func isHevcDelimiter(nalu []byte) bool {
+	return hevcNalType(nalu) == hevcNalAud
+}
+
+func isHevcIrap(nalu []byte) bool {
+	t := hevcNalType(nalu)
+	return t >= hevcNalIrapFirst && t <= hevcNalIrapLast
+}
+
+type hevcSps struct {
+	width  int
+	height int
+	// for the HEVCDecoderConfigurationRecord
+	maxSubLayers      int
+	temporalIdNesting bool
+	profileTierLevel  []byte // general_profile_space to general_level_idc
+	chromaFormat      uint
+	bitDepthLuma      uint
+	bitDepthChroma    uint
+}
+
+func parseHevcSps(nalu []byte) (hevcSps, error) {
+	sps := hevcSps{}
+	if len(nalu) < 16 {
+		return sps, &TsParseError{Msg: "H.265 SPS too short"}
+	}
+	rbsp := nalUnitRbsp(nalu[2:])
+	if len(rbsp) < 13 {
+		return sps, &TsParseError{Msg: "H.265 SPS too short"}
+	}
+	sps.maxSubLayers = int(rbsp[0]>>1&0x07) + 1
+	sps.temporalIdNesting = rbsp[0]&0x01 != 0
+	// the general part of profile_tier_level is byte aligned
+	sps.profileTierLevel = append([]byte{}, rbsp[1:13]...)
+	r := &bitReader{data: rbsp, pos: 13 * 8}
+	subLayerProfile := make([]bool, sps.maxSubLayers-1)
+	subLayerLevel := make([]bool, sps.maxSubLayers-1)
+	for i := range sps.maxSubLayers - 1 {
+		subLayerProfile[i] = r.bit() == 1
+		subLayerLevel[i] = r.bit() == 1
+	}
+	if sps.maxSubLayers > 1 {
+		r.bits(2 * (9 - sps.maxSubLayers)) // reserved
+	}
+	for i := range sps.maxSubLayers - 1 {
+		if subLayerProfile[i] {
+			r.bits(88)
+		}
+		if subLayerLevel[i] {
+			r.bits(8)
+		}
+	}
+	r.ue() // sps_seq_parameter_set_id
+	sps.chromaFormat = r.ue()
+	if sps.chromaFormat == 3 {
+		r.bit() // separate_colour_plane_flag
+	}
+	sps.width = int(r.ue())
+	sps.height = int(r.ue())
+	if r.bit() == 1 {
+		// conformance window
+		cropUnitX, cropUnitY := 1, 1
+		switch sps.chromaFormat {
+		case 1:
+			cropUnitX, cropUnitY = 2, 2
+		case 2:
+			cropUnitX = 2
+		}
+		left, right, top, bottom := int(r.ue()), int(r.ue()), int(r.ue()), int(r.ue())
+		sps.width -= cropUnitX * (left + right)
+		sps.height -= cropUnitY * (top + bottom)
+	}
+	sps.bitDepthLuma = r.ue() + 8
+	sps.bitDepthChroma = r.ue() + 8
+	if r.overrun() || sps.width <= 0 || sps.height <= 0 || sps.chromaFormat > 3 {
+		return sps, &TsParseError{Msg: "invalid H.265 SPS"}
+	}
+	return sps, nil
+}
+
+// HEVCDecoderConfigurationRecord (ISO/IEC 14496-15)
+func hevcDecoderConfig(vps []byte, sps []byte, pps []byte) []byte {
+	info, _ := parseHevcSps(sps) // already checked by the frame reader
+	b := append([]byte{1}, info.profileTierLevel...)
+	b = append(b,
+		0xf0, 0x00, // min_spatial_segmentation_idc
+		0xfc,                             // parallelismType
+		0xfc|byte(info.chromaFormat),     // chromaFormat
+		0xf8|byte(info.bitDepthLuma-8),   // bitDepthLumaMinus8
+		0xf8|byte(info.bitDepthChroma-8), // bitDepthChromaMinus8
+		0x00, 0x00,                       // avgFrameRate
+	)
+	nesting := byte(0)
+	if info.temporalIdNesting {
+		nesting = 1
+	}
+	// numTemporalLayers, temporalIdNested, lengthSizeMinusOne; numOfArrays
+	b = append(b, byte(info.maxSubLayers)<<3|nesting<<2|3, 3)
+	for _, nalu := range [][]byte{vps, sps, pps} {
+		b = append(b, 0x80|hevcNalType(nalu)) // array_completeness
+		b = binary.BigEndian.AppendUint16(b, 1)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(nalu)))
+		b = append(b, nalu...)
+	}
+	return b
+}
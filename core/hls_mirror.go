@@ -0,0 +1,167 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"remotebranch.eu/ChaoticByte/lurch-dl/core/m3u8"
+)
+
+const (
+	LayoutFile = "file" // everything in one file
+	LayoutHls  = "hls"  // the segments as separate files and a playlist
+)
+
+var Layouts = []string{LayoutFile, LayoutHls}
+
+const HlsMasterPlaylist = "master.m3u8"
+
+// The directory of an HLS mirror, the filename without the .ts extension
+func HlsMirrorDir(filename string) string {
+	return strings.TrimSuffix(filename, ".ts")
+}
+
+// Mirrors a format as HLS into a directory: The segments are saved as
+// they are into <Dir>/<Name>/, the VOD playlist <Dir>/<Name>.m3u8 is
+// written when the download is complete. Every segment is renamed into
+// place when it's complete, so continuing a download never has to
+// discard anything.
+type HlsSink struct {
+	Dir       string
+	Name      string
+	Overwrite bool
+	// The (cut) chunk list of the download, for the playlist
+	ChunkList *ChunkList
+}
+
+func NewHlsSink(dir string, name string, chunklist *ChunkList, overwrite bool) *HlsSink {
+	return &HlsSink{Dir: dir, Name: name, ChunkList: chunklist, Overwrite: overwrite}
+}
+
+func (s *HlsSink) PlaylistFilename() string {
+	return filepath.Join(s.Dir, sanitizeUnicodeFilename(s.Name)+".m3u8")
+}
+
+func (s *HlsSink) segmentDir() string {
+	return filepath.Join(s.Dir, sanitizeUnicodeFilename(s.Name))
+}
+
+func hlsSegmentFilename(chunk Chunk) string {
+	return sanitizeUnicodeFilename(chunk.Name)
+}
+
+func (s *HlsSink) Open(offset int64) (int64, error) {
+	if offset == 0 && !s.Overwrite {
+		if _, err := os.Stat(s.PlaylistFilename()); err == nil {
+			return 0, &FileExistsError{Filename: s.PlaylistFilename()}
+		}
+	}
+	// the committed segments are complete files
+	return max(offset, 0), os.MkdirAll(s.segmentDir(), 0770)
+}
+
+func (s *HlsSink) WriteChunk(chunk Chunk, data []byte) error {
+	filename := filepath.Join(s.segmentDir(), hlsSegmentFilename(chunk))
+	return writeFileSync(filename, data)
+}
+
+func (s *HlsSink) Commit() error {
+	return syncDir(s.segmentDir())
+}
+
+func (s *HlsSink) Close(complete bool) error {
+	if !complete {
+		return nil
+	}
+	targetDuration := s.ChunkList.ChunkDuration
+	for _, c := range s.ChunkList.Chunks {
+		targetDuration = max(targetDuration, c.Duration.Seconds())
+	}
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", int(math.Ceil(targetDuration)))
+	dir := url.PathEscape(sanitizeUnicodeFilename(s.Name))
+	for _, c := range s.ChunkList.Chunks {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s/%s\n", c.Duration.Seconds(), dir, url.PathEscape(hlsSegmentFilename(c)))
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	err := writeFileSync(s.PlaylistFilename(), []byte(b.String()))
+	if err == nil {
+		err = syncDir(s.Dir)
+	}
+	return err
+}
+
+// Write the master playlist of the mirrored formats in dir. The
+// bandwidth of the formats is calculated from the size of their
+// segments.
+func WriteHlsMasterPlaylist(dir string, formatNames []string) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, name := range formatNames {
+		playlist := sanitizeUnicodeFilename(name) + ".m3u8"
+		data, err := os.ReadFile(filepath.Join(dir, playlist))
+		if err != nil {
+			return err
+		}
+		// the segment URIs stay relative to dir
+		mediaPlaylist, err := m3u8.ParseMedia(data, "")
+		if err != nil {
+			return err
+		}
+		var peak, size, duration float64
+		for _, c := range mediaPlaylist.Segments {
+			segment, err := url.PathUnescape(c.Uri)
+			if err != nil {
+				return err
+			}
+			info, err := os.Stat(filepath.Join(dir, segment))
+			if err != nil {
+				return err
+			}
+			bits := float64(info.Size() * 8)
+			if c.Duration > 0 {
+				peak = max(peak, bits/c.Duration.Seconds())
+			}
+			size += bits
+			duration += c.Duration.Seconds()
+		}
+		average := peak
+		if duration > 0 {
+			average = size / duration
+		}
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,AVERAGE-BANDWIDTH=%d,NAME=\"%s\"\n%s\n",
+			int64(math.Ceil(peak)), int64(math.Ceil(average)), name, url.PathEscape(playlist))
+	}
+	err := writeFileSync(filepath.Join(dir, HlsMasterPlaylist), []byte(b.String()))
+	if err == nil {
+		err = syncDir(dir)
+	}
+	return err
+}
+
+// Write a file completely or not at all
+func writeFileSync(filename string, data []byte) error {
+	tmpFilename := filename + ".part"
+	f, err := os.OpenFile(tmpFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmpFilename, filename)
+	}
+	return err
+}
@@ -0,0 +1,256 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Serves the formats of stream episodes as local HLS playlists and
+// proxies their segments, so they can be watched in any player:
+//
+//	/<episode>/<format>.m3u8[?chapter=<n>][&start=<duration>][&stop=<duration>]
+//
+// Segments are fetched with the usual headers, rate limiter and retry
+// policy. If CacheDir is set, they are cached on disk.
+type HlsProxy struct {
+	Limiter     *RateLimiter
+	RetryPolicy RetryPolicy
+	CacheDir    string
+	mux         *http.ServeMux
+	mutex       sync.Mutex
+	episodes    map[string]*StreamEpisode
+	chunklists  map[string]*proxyChunkList
+	keys        *chunkKeys
+	loadEpisode func(ctx context.Context, number string) (StreamEpisode, error)
+}
+
+func NewHlsProxy(limiter *RateLimiter, policy RetryPolicy, cacheDir string) *HlsProxy {
+	p := &HlsProxy{
+		Limiter:     limiter,
+		RetryPolicy: policy,
+		CacheDir:    cacheDir,
+		mux:         http.NewServeMux(),
+		episodes:    map[string]*StreamEpisode{},
+		chunklists:  map[string]*proxyChunkList{},
+		keys:        newChunkKeys(),
+	}
+	p.loadEpisode = func(ctx context.Context, number string) (StreamEpisode, error) {
+		return StreamEpisodeFromUrl(ctx, fmt.Sprintf(StreamEpisodeUrlTemplate, number), p.RetryPolicy)
+	}
+	p.mux.HandleFunc("GET /{episode}/{playlist}", p.servePlaylist)
+	p.mux.HandleFunc("GET /{episode}/{format}/{segment}", p.serveSegment)
+	return p
+}
+
+func (p *HlsProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+type proxyChunkList struct {
+	chunklist *ChunkList
+	loaded    time.Time
+}
+
+// Chunks can still be added to live chunk lists, they are fetched again
+// after the target duration
+func (c *proxyChunkList) expired() bool {
+	return c.chunklist.Live && time.Since(c.loaded).Seconds() >= c.chunklist.ChunkDuration
+}
+
+// The metadata of episodes and the chunk lists of finished episodes are
+// only fetched once
+func (p *HlsProxy) episode(ctx context.Context, number string) (*StreamEpisode, error) {
+	p.mutex.Lock()
+	ep, ok := p.episodes[number]
+	p.mutex.Unlock()
+	if ok {
+		return ep, nil
+	}
+	loaded, err := p.loadEpisode(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.episodes[number] = &loaded
+	return &loaded, nil
+}
+
+func (p *HlsProxy) chunklist(ctx context.Context, format *VideoFormat) (*ChunkList, error) {
+	p.mutex.Lock()
+	cached, ok := p.chunklists[format.Url]
+	p.mutex.Unlock()
+	if ok && !cached.expired() {
+		return cached.chunklist, nil
+	}
+	loaded, err := format.StreamChunkList(ctx, p.RetryPolicy)
+	if err != nil {
+		return nil, err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.chunklists[format.Url] = &proxyChunkList{chunklist: &loaded, loaded: time.Now()}
+	return &loaded, nil
+}
+
+func (p *HlsProxy) format(ctx context.Context, episodeNumber string, formatName string) (*StreamEpisode, VideoFormat, *ChunkList, error) {
+	ep, err := p.episode(ctx, episodeNumber)
+	if err != nil {
+		return nil, VideoFormat{}, nil, err
+	}
+	if len(ep.Formats) == 0 {
+		return nil, VideoFormat{}, nil, &FormatNotFoundError{FormatName: formatName}
+	}
+	format, err := ep.FormatByName(formatName)
+	if err != nil {
+		return nil, format, nil, err
+	}
+	chunklist, err := p.chunklist(ctx, &format)
+	return ep, format, chunklist, err
+}
+
+func (p *HlsProxy) servePlaylist(w http.ResponseWriter, r *http.Request) {
+	formatName, ok := strings.CutSuffix(r.PathValue("playlist"), ".m3u8")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	ep, format, chunklist, err := p.format(r.Context(), r.PathValue("episode"), formatName)
+	if err != nil {
+		hlsProxyError(w, err)
+		return
+	}
+	start, stop := time.Duration(-1), time.Duration(-1)
+	query := r.URL.Query()
+	if query.Has("chapter") {
+		n, err := strconv.Atoi(query.Get("chapter"))
+		if err != nil {
+			http.Error(w, "invalid chapter", http.StatusBadRequest)
+			return
+		}
+		chapter, err := ep.ChapterByNumber(n)
+		if err != nil {
+			hlsProxyError(w, err)
+			return
+		}
+		if chapter != nil {
+			start, stop = chapter.StartOffset, chapter.EndOffset
+		}
+	}
+	for name, value := range map[string]*time.Duration{"start": &start, "stop": &stop} {
+		if query.Has(name) {
+			*value, err = time.ParseDuration(query.Get(name))
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	cut := chunklist.Cut(start, stop)
+	targetDuration := cut.ChunkDuration
+	for _, c := range cut.Chunks {
+		targetDuration = max(targetDuration, c.Duration.Seconds())
+	}
+	// players reload live playlists until the end tag is added
+	playlistType := "VOD"
+	if chunklist.Live {
+		playlistType = "EVENT"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:%s\n", playlistType)
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", int(math.Ceil(targetDuration)))
+	for i, c := range cut.Chunks {
+		// relative to the playlist, the index in the uncut chunk list
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s/%d.ts\n", c.Duration.Seconds(), url.PathEscape(format.Name), cut.FirstChunk+i)
+	}
+	if !chunklist.Live {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Write([]byte(b.String()))
+}
+
+func (p *HlsProxy) serveSegment(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("segment"), ".ts"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	_, format, chunklist, err := p.format(r.Context(), r.PathValue("episode"), r.PathValue("format"))
+	if err != nil {
+		hlsProxyError(w, err)
+		return
+	}
+	if index < 0 || index >= len(chunklist.Chunks) {
+		http.NotFound(w, r)
+		return
+	}
+	chunk := chunklist.Chunks[index]
+	data, err := p.segment(r.Context(), r.PathValue("episode"), format.Name, &chunk)
+	if err != nil {
+		hlsProxyError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Write(data)
+}
+
+// Segments are served and cached decrypted
+func (p *HlsProxy) segment(ctx context.Context, episodeNumber string, formatName string, chunk *Chunk) ([]byte, error) {
+	var cacheFilename string
+	if p.CacheDir != "" {
+		cacheFilename = filepath.Join(p.CacheDir, sanitizeUnicodeFilename(episodeNumber), sanitizeUnicodeFilename(formatName), filepath.Base(chunk.Url))
+		if data, err := os.ReadFile(cacheFilename); err == nil {
+			return data, nil
+		}
+	}
+	var data []byte
+	err := p.RetryPolicy.do(ctx, func() error {
+		var err error
+		data, err = httpGet(ctx, chunk.Url, ApiHeadersVideoAdditional, time.Second*5, p.Limiter)
+		if err == nil {
+			data, err = p.keys.decrypt(ctx, chunk, data)
+		}
+		return err
+	}, nil)
+	if err != nil || cacheFilename == "" {
+		return data, err
+	}
+	// the cache is optional, errors are ignored
+	if os.MkdirAll(filepath.Dir(cacheFilename), 0770) == nil {
+		tmpFilename := cacheFilename + ".tmp"
+		if os.WriteFile(tmpFilename, data, 0660) == nil {
+			os.Rename(tmpFilename, cacheFilename)
+		}
+	}
+	return data, nil
+}
+
+func hlsProxyError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	var httpErr *HttpStatusCodeError
+	var formatErr *FormatNotFoundError
+	var chapterErr *ChapterNotFoundError
+	var urlErr *GtvVideoUrlParseError
+	var expressionErr *FormatExpressionError
+	switch {
+	case errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound,
+		errors.As(err, &formatErr), errors.As(err, &chapterErr), errors.As(err, &urlErr):
+		status = http.StatusNotFound
+	case errors.As(err, &expressionErr):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The playlist of a running stream: two chunks, then three with the end
+// tag
+func newGrowingPlaylistProxy(t *testing.T) (*HlsProxy, *atomic.Int32) {
+	t.Helper()
+	playlistRequests := &atomic.Int32{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := 2
+		if playlistRequests.Add(1) > 1 {
+			n = 3
+		}
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-PLAYLIST-TYPE:EVENT\n")
+		for i := range n {
+			fmt.Fprintf(&b, "#EXTINF:1,\nc%v.ts\n", i)
+		}
+		if n == 3 {
+			b.WriteString("#EXT-X-ENDLIST\n")
+		}
+		w.Write([]byte(b.String()))
+	}))
+	t.Cleanup(upstream.Close)
+	p := NewHlsProxy(nil, RetryPolicy{MaxAttempts: 1}, "")
+	p.loadEpisode = func(ctx context.Context, number string) (StreamEpisode, error) {
+		return StreamEpisode{Id: number, Formats: []VideoFormat{{Name: "720p", Url: upstream.URL + "/720p.m3u8"}}}, nil
+	}
+	return p, playlistRequests
+}
+
+func testProxyPlaylist(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	resp, err := http.Get(srv.URL + "/777/720p.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %v, %v", resp.StatusCode, err)
+	}
+	return string(body)
+}
+
+func TestHlsProxyLivePlaylist(t *testing.T) {
+	p, playlistRequests := newGrowingPlaylistProxy(t)
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	playlist := testProxyPlaylist(t, srv)
+	if strings.Count(playlist, ".ts\n") != 2 || strings.Contains(playlist, "#EXT-X-ENDLIST") || !strings.Contains(playlist, "#EXT-X-PLAYLIST-TYPE:EVENT") {
+		t.Errorf("unexpected live playlist:\n%v", playlist)
+	}
+	// cached for the target duration
+	testProxyPlaylist(t, srv)
+	if n := playlistRequests.Load(); n != 1 {
+		t.Errorf("the chunk list was fetched %v times", n)
+	}
+	time.Sleep(time.Second)
+	playlist = testProxyPlaylist(t, srv)
+	if strings.Count(playlist, ".ts\n") != 3 || !strings.Contains(playlist, "#EXT-X-ENDLIST") || !strings.Contains(playlist, "#EXT-X-PLAYLIST-TYPE:VOD") {
+		t.Errorf("unexpected finished playlist:\n%v", playlist)
+	}
+	// finished chunk lists don't expire
+	time.Sleep(time.Second)
+	testProxyPlaylist(t, srv)
+	if n := playlistRequests.Load(); n != 2 {
+		t.Errorf("the chunk list was fetched %v times instead of 2", n)
+	}
+}
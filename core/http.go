@@ -3,8 +3,10 @@
 package core
 
 import (
+	"context"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -31,22 +33,67 @@ var ApiHeadersVideoAdditional = http.Header{
 	"Accept": {"*/*"},
 }
 
-func httpGet(url string, additionalHeaders http.Header, timeout time.Duration) ([]byte, error) {
+// The timeout applies to stalled requests, waiting for the rate limiter
+// (optional) doesn't count.
+func httpGet(ctx context.Context, url string, additionalHeaders http.Header, timeout time.Duration, limiter *RateLimiter) ([]byte, error) {
 	data := []byte{}
-	req, err := http.NewRequest("GET", url, nil)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := time.AfterFunc(timeout, cancel)
+	defer timer.Stop()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return data, err
 	}
 	for k, v := range ApiHeadersBase { req.Header.Set(k, v[0]) }
 	for k, v := range additionalHeaders { req.Header.Set(k, v[0]) }
-	client := &http.Client{Timeout: timeout}
+	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		return data, err
 	}
-	data, err = io.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	timer.Reset(timeout)
+	data, err = io.ReadAll(&timeoutReader{ctx: ctx, r: resp.Body, timer: timer, timeout: timeout, limiter: limiter})
 	if resp.StatusCode != 200 {
-		return data, &HttpStatusCodeError{Url: url, StatusCode: resp.StatusCode}
+		return data, &HttpStatusCodeError{Url: url, StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if err == nil && resp.ContentLength >= 0 && int64(len(data)) != resp.ContentLength {
+		err = &HttpContentLengthError{Url: url, Size: len(data), Expected: resp.ContentLength}
 	}
 	return data, err
 }
+
+type timeoutReader struct {
+	ctx     context.Context
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+	limiter *RateLimiter
+}
+
+func (tr *timeoutReader) Read(p []byte) (int, error) {
+	if tr.limiter != nil {
+		// don't read more than the bucket can hold at once
+		p = p[:min(len(p), max(int(tr.limiter.burst), 1))]
+	}
+	n, err := tr.r.Read(p)
+	if n > 0 && tr.limiter != nil {
+		tr.timer.Stop()
+		if waitErr := tr.limiter.WaitN(tr.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	tr.timer.Reset(tr.timeout)
+	return n, err
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
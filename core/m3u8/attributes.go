@@ -0,0 +1,164 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package m3u8
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// An attribute list (RFC 8216, 4.2). The values are stored as they
+// appear in the playlist, quoted strings with their quotes, and are
+// converted by the typed getters.
+type Attributes map[string]string
+
+type Resolution struct {
+	Width  int
+	Height int
+}
+
+func isAttributeNameChar(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-'
+}
+
+func ParseAttributes(s string) (Attributes, error) {
+	attrs := Attributes{}
+	i := 0
+	for i < len(s) {
+		start := i
+		for i < len(s) && isAttributeNameChar(s[i]) {
+			i++
+		}
+		name := s[start:i]
+		if name == "" || i >= len(s) || s[i] != '=' {
+			return nil, &AttributeError{Name: name, Msg: "expected NAME=VALUE at '" + s[start:] + "'"}
+		}
+		i++
+		start = i
+		if i < len(s) && s[i] == '"' {
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, &AttributeError{Name: name, Msg: "unterminated quoted string"}
+			}
+			i += end + 2
+		} else {
+			for i < len(s) && s[i] != ',' {
+				i++
+			}
+		}
+		value := s[start:i]
+		if value == "" {
+			return nil, &AttributeError{Name: name, Msg: "empty value"}
+		}
+		if _, ok := attrs[name]; ok {
+			return nil, &AttributeError{Name: name, Msg: "duplicate attribute"}
+		}
+		attrs[name] = value
+		if i < len(s) {
+			if s[i] != ',' {
+				return nil, &AttributeError{Name: name, Msg: "expected a comma after the value"}
+			}
+			i++
+			if i == len(s) {
+				return nil, &AttributeError{Name: name, Msg: "trailing comma"}
+			}
+		}
+	}
+	return attrs, nil
+}
+
+func (a Attributes) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+func (a Attributes) value(name string) (string, error) {
+	v, ok := a[name]
+	if !ok {
+		return "", &AttributeError{Name: name, Msg: "missing"}
+	}
+	return v, nil
+}
+
+func (a Attributes) QuotedString(name string) (string, error) {
+	v, err := a.value(name)
+	if err != nil {
+		return "", err
+	}
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return "", &AttributeError{Name: name, Msg: "not a quoted string"}
+	}
+	return v[1 : len(v)-1], nil
+}
+
+func (a Attributes) EnumeratedString(name string) (string, error) {
+	v, err := a.value(name)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(v, "\", ") {
+		return "", &AttributeError{Name: name, Msg: "not an enumerated string"}
+	}
+	return v, nil
+}
+
+func (a Attributes) Int(name string) (int64, error) {
+	v, err := a.value(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(v, 10, 63)
+	if err != nil {
+		return 0, &AttributeError{Name: name, Msg: "not a decimal integer"}
+	}
+	return int64(n), nil
+}
+
+func (a Attributes) Float(name string) (float64, error) {
+	v, err := a.value(name)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || strings.ContainsAny(v, "eEnNiI") {
+		return 0, &AttributeError{Name: name, Msg: "not a decimal floating point number"}
+	}
+	return f, nil
+}
+
+func (a Attributes) HexSequence(name string) ([]byte, error) {
+	v, err := a.value(name)
+	if err != nil {
+		return nil, err
+	}
+	digits, ok := strings.CutPrefix(v, "0x")
+	if !ok {
+		digits, ok = strings.CutPrefix(v, "0X")
+	}
+	if !ok || digits == "" {
+		return nil, &AttributeError{Name: name, Msg: "not a hexadecimal sequence"}
+	}
+	if len(digits)%2 != 0 {
+		digits = "0" + digits
+	}
+	b, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, &AttributeError{Name: name, Msg: "not a hexadecimal sequence"}
+	}
+	return b, nil
+}
+
+func (a Attributes) Resolution(name string) (Resolution, error) {
+	v, err := a.value(name)
+	if err != nil {
+		return Resolution{}, err
+	}
+	w, h, ok := strings.Cut(v, "x")
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if !ok || err1 != nil || err2 != nil || width < 0 || height < 0 {
+		return Resolution{}, &AttributeError{Name: name, Msg: "not a decimal resolution"}
+	}
+	return Resolution{Width: width, Height: height}, nil
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package m3u8
+
+import "fmt"
+
+type ParseError struct {
+	Line int // 1-based, 0 if the error is not about a specific line
+	Msg  string
+}
+
+func (err *ParseError) Error() string {
+	if err.Line > 0 {
+		return fmt.Sprintf("invalid playlist: line %v: %v", err.Line, err.Msg)
+	}
+	return "invalid playlist: " + err.Msg
+}
+
+type AttributeError struct {
+	Name string
+	Msg  string
+}
+
+func (err *AttributeError) Error() string {
+	if err.Name == "" {
+		return "attributes: " + err.Msg
+	}
+	return fmt.Sprintf("attribute %v: %v", err.Name, err.Msg)
+}
+
+type PlaylistTypeError struct {
+	Expected string // master or media
+}
+
+func (err *PlaylistTypeError) Error() string {
+	return "not a " + err.Expected + " playlist"
+}
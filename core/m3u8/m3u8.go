@@ -0,0 +1,545 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+// Package m3u8 parses HLS master and media playlists (RFC 8216).
+//
+// URIs are resolved against the URL of the playlist. Tags that are not
+// known are ignored, as required by the RFC.
+package m3u8
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Playlist types of EXT-X-PLAYLIST-TYPE
+const (
+	PlaylistTypeVod   = "VOD"
+	PlaylistTypeEvent = "EVENT"
+)
+
+// Encryption methods of EXT-X-KEY
+const (
+	KeyMethodNone      = "NONE"
+	KeyMethodAes128    = "AES-128"
+	KeyMethodSampleAes = "SAMPLE-AES"
+)
+
+// A rendition of EXT-X-MEDIA
+type Media struct {
+	Type       string // AUDIO, VIDEO, SUBTITLES or CLOSED-CAPTIONS
+	GroupId    string
+	Name       string
+	Language   string
+	Default    bool
+	Autoselect bool
+	Uri        string // empty if the rendition is part of the variants
+	Attributes Attributes
+}
+
+// A variant stream of EXT-X-STREAM-INF
+type Variant struct {
+	Uri              string
+	Bandwidth        int64 // in Bits/s
+	AverageBandwidth int64 // 0 if unknown
+	Codecs           string
+	Resolution       Resolution // zero if unknown
+	FrameRate        float64    // 0 if unknown
+	Audio            string     // group ids of the renditions
+	Video            string
+	Subtitles        string
+	Attributes       Attributes
+}
+
+type MasterPlaylist struct {
+	Version             int
+	IndependentSegments bool
+	Variants            []Variant
+	Media               []Media
+}
+
+// A sub-range of a resource, of EXT-X-BYTERANGE or EXT-X-MAP
+type ByteRange struct {
+	Length int64
+	Offset int64
+}
+
+// EXT-X-KEY
+type Key struct {
+	Method            string
+	Uri               string
+	Iv                []byte // nil if the media sequence number is used
+	KeyFormat         string
+	KeyFormatVersions string
+}
+
+// EXT-X-MAP, the initialization section of the segments
+type Map struct {
+	Uri       string
+	ByteRange *ByteRange // nil for the whole resource
+}
+
+type Segment struct {
+	Uri             string
+	Duration        time.Duration
+	Title           string
+	SequenceNumber  int64
+	Discontinuity   bool       // the segment follows a discontinuity
+	ByteRange       *ByteRange // nil for the whole resource
+	Key             *Key       // nil if the segment is not encrypted
+	Map             *Map
+	ProgramDateTime time.Time // zero if unknown
+}
+
+type MediaPlaylist struct {
+	Version               int
+	TargetDuration        time.Duration
+	MediaSequence         int64
+	DiscontinuitySequence int64
+	PlaylistType          string // PlaylistTypeVod, PlaylistTypeEvent or empty
+	IndependentSegments   bool
+	EndList               bool // no segments will be added
+	Segments              []Segment
+}
+
+type line struct {
+	number int
+	text   string
+}
+
+func lines(data []byte) ([]line, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	result := []line{}
+	for i, l := range strings.Split(string(data), "\n") {
+		l = strings.TrimRight(l, "\r")
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		result = append(result, line{number: i + 1, text: l})
+	}
+	if len(result) == 0 || result[0].text != "#EXTM3U" {
+		return nil, &ParseError{Line: 1, Msg: "#EXTM3U missing"}
+	}
+	return result[1:], nil
+}
+
+func isTag(l string) bool {
+	return strings.HasPrefix(l, "#EXT")
+}
+
+func isComment(l string) bool {
+	return strings.HasPrefix(l, "#") && !isTag(l)
+}
+
+func resolveUri(base *url.URL, uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if base == nil {
+		return uri, nil
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+func parseBaseUrl(playlistUrl string) (*url.URL, error) {
+	if playlistUrl == "" {
+		return nil, nil
+	}
+	return url.Parse(playlistUrl)
+}
+
+// Tags that only appear in media playlists
+var mediaTags = []string{"#EXTINF", "#EXT-X-TARGETDURATION", "#EXT-X-MEDIA-SEQUENCE", "#EXT-X-ENDLIST", "#EXT-X-PLAYLIST-TYPE", "#EXT-X-BYTERANGE", "#EXT-X-MAP"}
+
+// Tags that only appear in master playlists
+var masterTags = []string{"#EXT-X-STREAM-INF", "#EXT-X-MEDIA", "#EXT-X-I-FRAME-STREAM-INF", "#EXT-X-SESSION-DATA"}
+
+func parseVersion(l line, value string) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 1 {
+		return 0, &ParseError{Line: l.number, Msg: "invalid EXT-X-VERSION"}
+	}
+	return v, nil
+}
+
+func attributeError(l line, tag string, err error) error {
+	return &ParseError{Line: l.number, Msg: tag + ": " + err.Error()}
+}
+
+// Parse a master playlist, playlistUrl is used to resolve the URIs of
+// the variants and renditions. If it's empty, the URIs stay as they are.
+func ParseMaster(data []byte, playlistUrl string) (*MasterPlaylist, error) {
+	base, err := parseBaseUrl(playlistUrl)
+	if err != nil {
+		return nil, &ParseError{Msg: "invalid playlist url: " + err.Error()}
+	}
+	ls, err := lines(data)
+	if err != nil {
+		return nil, err
+	}
+	pl := &MasterPlaylist{Version: 1}
+	var pending *Variant
+	var pendingLine line
+	for _, l := range ls {
+		if isComment(l.text) {
+			continue
+		}
+		if !isTag(l.text) {
+			if pending == nil {
+				return nil, &ParseError{Line: l.number, Msg: "URI without EXT-X-STREAM-INF"}
+			}
+			pending.Uri, err = resolveUri(base, l.text)
+			if err != nil {
+				return nil, &ParseError{Line: l.number, Msg: "invalid URI: " + err.Error()}
+			}
+			pl.Variants = append(pl.Variants, *pending)
+			pending = nil
+			continue
+		}
+		tag, value, _ := strings.Cut(l.text, ":")
+		for _, t := range mediaTags {
+			if tag == t {
+				return nil, &PlaylistTypeError{Expected: "master"}
+			}
+		}
+		switch tag {
+		case "#EXT-X-VERSION":
+			pl.Version, err = parseVersion(l, value)
+			if err != nil {
+				return nil, err
+			}
+		case "#EXT-X-INDEPENDENT-SEGMENTS":
+			pl.IndependentSegments = true
+		case "#EXT-X-STREAM-INF":
+			if pending != nil {
+				return nil, &ParseError{Line: pendingLine.number, Msg: "EXT-X-STREAM-INF without URI"}
+			}
+			v, err := parseVariant(value)
+			if err != nil {
+				return nil, attributeError(l, "EXT-X-STREAM-INF", err)
+			}
+			pending, pendingLine = &v, l
+		case "#EXT-X-MEDIA":
+			m, err := parseMedia(value, base)
+			if err != nil {
+				return nil, attributeError(l, "EXT-X-MEDIA", err)
+			}
+			pl.Media = append(pl.Media, m)
+		}
+	}
+	if pending != nil {
+		return nil, &ParseError{Line: pendingLine.number, Msg: "EXT-X-STREAM-INF without URI"}
+	}
+	return pl, nil
+}
+
+func parseVariant(value string) (Variant, error) {
+	attrs, err := ParseAttributes(value)
+	if err != nil {
+		return Variant{}, err
+	}
+	v := Variant{Attributes: attrs}
+	if v.Bandwidth, err = attrs.Int("BANDWIDTH"); err != nil {
+		return v, err
+	}
+	if attrs.Has("AVERAGE-BANDWIDTH") {
+		if v.AverageBandwidth, err = attrs.Int("AVERAGE-BANDWIDTH"); err != nil {
+			return v, err
+		}
+	}
+	if attrs.Has("RESOLUTION") {
+		if v.Resolution, err = attrs.Resolution("RESOLUTION"); err != nil {
+			return v, err
+		}
+	}
+	if attrs.Has("FRAME-RATE") {
+		if v.FrameRate, err = attrs.Float("FRAME-RATE"); err != nil {
+			return v, err
+		}
+	}
+	for name, field := range map[string]*string{"CODECS": &v.Codecs, "AUDIO": &v.Audio, "VIDEO": &v.Video, "SUBTITLES": &v.Subtitles} {
+		if attrs.Has(name) {
+			if *field, err = attrs.QuotedString(name); err != nil {
+				return v, err
+			}
+		}
+	}
+	return v, nil
+}
+
+func parseMedia(value string, base *url.URL) (Media, error) {
+	attrs, err := ParseAttributes(value)
+	if err != nil {
+		return Media{}, err
+	}
+	m := Media{Attributes: attrs}
+	if m.Type, err = attrs.EnumeratedString("TYPE"); err != nil {
+		return m, err
+	}
+	if m.GroupId, err = attrs.QuotedString("GROUP-ID"); err != nil {
+		return m, err
+	}
+	if m.Name, err = attrs.QuotedString("NAME"); err != nil {
+		return m, err
+	}
+	if attrs.Has("LANGUAGE") {
+		if m.Language, err = attrs.QuotedString("LANGUAGE"); err != nil {
+			return m, err
+		}
+	}
+	if attrs.Has("URI") {
+		uri, err := attrs.QuotedString("URI")
+		if err != nil {
+			return m, err
+		}
+		if m.Uri, err = resolveUri(base, uri); err != nil {
+			return m, &AttributeError{Name: "URI", Msg: err.Error()}
+		}
+	}
+	for name, field := range map[string]*bool{"DEFAULT": &m.Default, "AUTOSELECT": &m.Autoselect} {
+		if attrs.Has(name) {
+			v, err := attrs.EnumeratedString(name)
+			if err != nil || (v != "YES" && v != "NO") {
+				return m, &AttributeError{Name: name, Msg: "must be YES or NO"}
+			}
+			*field = v == "YES"
+		}
+	}
+	return m, nil
+}
+
+// <n>[@<o>]
+func parseByteRange(s string) (ByteRange, bool, error) {
+	length, offset, hasOffset := strings.Cut(s, "@")
+	r := ByteRange{}
+	n, err := strconv.ParseUint(length, 10, 63)
+	if err != nil {
+		return r, false, &ParseError{Msg: "invalid byte range '" + s + "'"}
+	}
+	r.Length = int64(n)
+	if hasOffset {
+		o, err := strconv.ParseUint(offset, 10, 63)
+		if err != nil {
+			return r, false, &ParseError{Msg: "invalid byte range '" + s + "'"}
+		}
+		r.Offset = int64(o)
+	}
+	return r, hasOffset, nil
+}
+
+func parseKey(value string, base *url.URL) (*Key, error) {
+	attrs, err := ParseAttributes(value)
+	if err != nil {
+		return nil, err
+	}
+	k := &Key{}
+	if k.Method, err = attrs.EnumeratedString("METHOD"); err != nil {
+		return nil, err
+	}
+	if k.Method == KeyMethodNone {
+		if attrs.Has("URI") || attrs.Has("IV") {
+			return nil, &AttributeError{Name: "METHOD", Msg: "NONE must not have a URI or IV"}
+		}
+		return nil, nil
+	}
+	uri, err := attrs.QuotedString("URI")
+	if err != nil {
+		return nil, err
+	}
+	if k.Uri, err = resolveUri(base, uri); err != nil {
+		return nil, &AttributeError{Name: "URI", Msg: err.Error()}
+	}
+	if attrs.Has("IV") {
+		iv, err := attrs.HexSequence("IV")
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) > 16 {
+			return nil, &AttributeError{Name: "IV", Msg: "longer than 128 bits"}
+		}
+		// left-padded to 128 bits
+		k.Iv = append(make([]byte, 16-len(iv)), iv...)
+	}
+	if attrs.Has("KEYFORMAT") {
+		if k.KeyFormat, err = attrs.QuotedString("KEYFORMAT"); err != nil {
+			return nil, err
+		}
+	}
+	if attrs.Has("KEYFORMATVERSIONS") {
+		if k.KeyFormatVersions, err = attrs.QuotedString("KEYFORMATVERSIONS"); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func parseMap(value string, base *url.URL) (*Map, error) {
+	attrs, err := ParseAttributes(value)
+	if err != nil {
+		return nil, err
+	}
+	m := &Map{}
+	uri, err := attrs.QuotedString("URI")
+	if err != nil {
+		return nil, err
+	}
+	if m.Uri, err = resolveUri(base, uri); err != nil {
+		return nil, &AttributeError{Name: "URI", Msg: err.Error()}
+	}
+	if attrs.Has("BYTERANGE") {
+		s, err := attrs.QuotedString("BYTERANGE")
+		if err != nil {
+			return nil, err
+		}
+		r, hasOffset, err := parseByteRange(s)
+		if err != nil || !hasOffset {
+			return nil, &AttributeError{Name: "BYTERANGE", Msg: "must be <n>@<o>"}
+		}
+		m.ByteRange = &r
+	}
+	return m, nil
+}
+
+// Parse a media playlist, playlistUrl is used to resolve the URIs of the
+// segments, keys and maps. If it's empty, the URIs stay as they are.
+func ParseMedia(data []byte, playlistUrl string) (*MediaPlaylist, error) {
+	base, err := parseBaseUrl(playlistUrl)
+	if err != nil {
+		return nil, &ParseError{Msg: "invalid playlist url: " + err.Error()}
+	}
+	ls, err := lines(data)
+	if err != nil {
+		return nil, err
+	}
+	pl := &MediaPlaylist{Version: 1}
+	hasTargetDuration := false
+	// state for the next segment
+	var segment *Segment
+	var key *Key
+	var segmentMap *Map
+	discontinuity := false
+	// the end of the last byte range per URI, for ranges without offset
+	rangeEnds := map[string]int64{}
+	var pendingRange *ByteRange
+	pendingRangeHasOffset := false
+	var programDateTime time.Time
+	for _, l := range ls {
+		if isComment(l.text) {
+			continue
+		}
+		if !isTag(l.text) {
+			if segment == nil {
+				return nil, &ParseError{Line: l.number, Msg: "URI without EXTINF"}
+			}
+			segment.Uri, err = resolveUri(base, l.text)
+			if err != nil {
+				return nil, &ParseError{Line: l.number, Msg: "invalid URI: " + err.Error()}
+			}
+			segment.SequenceNumber = pl.MediaSequence + int64(len(pl.Segments))
+			segment.Key, segment.Map, segment.Discontinuity = key, segmentMap, discontinuity
+			if pendingRange != nil {
+				r := *pendingRange
+				if !pendingRangeHasOffset {
+					end, ok := rangeEnds[segment.Uri]
+					if !ok {
+						return nil, &ParseError{Line: l.number, Msg: "EXT-X-BYTERANGE without offset, but no previous range of the same URI"}
+					}
+					r.Offset = end
+				}
+				rangeEnds[segment.Uri] = r.Offset + r.Length
+				segment.ByteRange = &r
+			}
+			if !programDateTime.IsZero() {
+				segment.ProgramDateTime = programDateTime
+				programDateTime = programDateTime.Add(segment.Duration)
+			}
+			pl.Segments = append(pl.Segments, *segment)
+			segment, pendingRange, discontinuity = nil, nil, false
+			continue
+		}
+		tag, value, _ := strings.Cut(l.text, ":")
+		for _, t := range masterTags {
+			if tag == t {
+				return nil, &PlaylistTypeError{Expected: "media"}
+			}
+		}
+		switch tag {
+		case "#EXT-X-VERSION":
+			pl.Version, err = parseVersion(l, value)
+			if err != nil {
+				return nil, err
+			}
+		case "#EXT-X-INDEPENDENT-SEGMENTS":
+			pl.IndependentSegments = true
+		case "#EXT-X-TARGETDURATION":
+			// a decimal integer, but be lenient with fractions
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				return nil, &ParseError{Line: l.number, Msg: "invalid EXT-X-TARGETDURATION"}
+			}
+			pl.TargetDuration = time.Duration(seconds * float64(time.Second))
+			hasTargetDuration = true
+		case "#EXT-X-MEDIA-SEQUENCE", "#EXT-X-DISCONTINUITY-SEQUENCE":
+			if len(pl.Segments) > 0 || segment != nil {
+				return nil, &ParseError{Line: l.number, Msg: tag[1:] + " after the first segment"}
+			}
+			n, err := strconv.ParseUint(value, 10, 63)
+			if err != nil {
+				return nil, &ParseError{Line: l.number, Msg: "invalid " + tag[1:]}
+			}
+			if tag == "#EXT-X-MEDIA-SEQUENCE" {
+				pl.MediaSequence = int64(n)
+			} else {
+				pl.DiscontinuitySequence = int64(n)
+			}
+		case "#EXT-X-PLAYLIST-TYPE":
+			if value != PlaylistTypeVod && value != PlaylistTypeEvent {
+				return nil, &ParseError{Line: l.number, Msg: "invalid EXT-X-PLAYLIST-TYPE '" + value + "'"}
+			}
+			pl.PlaylistType = value
+		case "#EXT-X-ENDLIST":
+			pl.EndList = true
+		case "#EXTINF":
+			// #EXTINF:<duration>,[<title>]
+			durationStr, title, _ := strings.Cut(value, ",")
+			seconds, err := strconv.ParseFloat(strings.TrimSpace(durationStr), 64)
+			if err != nil || seconds < 0 {
+				return nil, &ParseError{Line: l.number, Msg: "invalid EXTINF duration '" + durationStr + "'"}
+			}
+			segment = &Segment{Duration: time.Duration(seconds * float64(time.Second)), Title: title}
+		case "#EXT-X-BYTERANGE":
+			r, hasOffset, err := parseByteRange(value)
+			if err != nil {
+				return nil, &ParseError{Line: l.number, Msg: err.(*ParseError).Msg}
+			}
+			pendingRange, pendingRangeHasOffset = &r, hasOffset
+		case "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+		case "#EXT-X-KEY":
+			key, err = parseKey(value, base)
+			if err != nil {
+				return nil, attributeError(l, "EXT-X-KEY", err)
+			}
+		case "#EXT-X-MAP":
+			segmentMap, err = parseMap(value, base)
+			if err != nil {
+				return nil, attributeError(l, "EXT-X-MAP", err)
+			}
+		case "#EXT-X-PROGRAM-DATE-TIME":
+			programDateTime, err = time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, &ParseError{Line: l.number, Msg: "invalid EXT-X-PROGRAM-DATE-TIME"}
+			}
+		}
+	}
+	if segment != nil {
+		return nil, &ParseError{Msg: "EXTINF without URI at the end"}
+	}
+	if !hasTargetDuration {
+		return nil, &ParseError{Msg: "EXT-X-TARGETDURATION missing"}
+	}
+	return pl, nil
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package m3u8
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testMaster = "\ufeff#EXTM3U\r\n" +
+	"#EXT-X-VERSION:4\r\n" +
+	"#EXT-X-INDEPENDENT-SEGMENTS\n" +
+	"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"English, main\",LANGUAGE=\"en\",DEFAULT=YES,URI=\"audio/en.m3u8\"\n" +
+	"# a comment\n" +
+	"\n" +
+	"#EXT-X-STREAM-INF:BANDWIDTH=6000000,AVERAGE-BANDWIDTH=5000000,RESOLUTION=1920x1080,FRAME-RATE=59.940,CODECS=\"avc1.64002a,mp4a.40.2\",AUDIO=\"aac\",NAME=\"1080p60\"\n" +
+	"1080p60/index.m3u8?token=abc\n" +
+	"#EXT-X-UNKNOWN-TAG:X=1\n" +
+	"#EXT-X-STREAM-INF:BANDWIDTH=800000\n" +
+	"https://other.example/360p.m3u8\n"
+
+func TestParseMaster(t *testing.T) {
+	pl, err := ParseMaster([]byte(testMaster), "https://cdn.example/v/master.m3u8?token=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pl.Version != 4 || !pl.IndependentSegments {
+		t.Errorf("version %v, independent segments %v", pl.Version, pl.IndependentSegments)
+	}
+	if len(pl.Variants) != 2 {
+		t.Fatalf("%v variants instead of 2", len(pl.Variants))
+	}
+	v := pl.Variants[0]
+	if v.Uri != "https://cdn.example/v/1080p60/index.m3u8?token=abc" {
+		t.Errorf("uri %v", v.Uri)
+	}
+	if v.Bandwidth != 6000000 || v.AverageBandwidth != 5000000 {
+		t.Errorf("bandwidth %v, average %v", v.Bandwidth, v.AverageBandwidth)
+	}
+	if v.Resolution != (Resolution{Width: 1920, Height: 1080}) || v.FrameRate != 59.94 {
+		t.Errorf("resolution %v, frame rate %v", v.Resolution, v.FrameRate)
+	}
+	if v.Codecs != "avc1.64002a,mp4a.40.2" || v.Audio != "aac" {
+		t.Errorf("codecs %v, audio %v", v.Codecs, v.Audio)
+	}
+	if name, err := v.Attributes.QuotedString("NAME"); err != nil || name != "1080p60" {
+		t.Errorf("name %v, %v", name, err)
+	}
+	if v := pl.Variants[1]; v.Uri != "https://other.example/360p.m3u8" || v.Resolution.Height != 0 || v.FrameRate != 0 {
+		t.Errorf("second variant %+v", v)
+	}
+	if len(pl.Media) != 1 {
+		t.Fatalf("%v renditions instead of 1", len(pl.Media))
+	}
+	m := pl.Media[0]
+	if m.Type != "AUDIO" || m.GroupId != "aac" || m.Name != "English, main" || m.Language != "en" || !m.Default || m.Autoselect {
+		t.Errorf("rendition %+v", m)
+	}
+	if m.Uri != "https://cdn.example/v/audio/en.m3u8" {
+		t.Errorf("rendition uri %v", m.Uri)
+	}
+}
+
+func TestParseMasterWithoutUrl(t *testing.T) {
+	pl, err := ParseMaster([]byte(testMaster), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pl.Variants[0].Uri != "1080p60/index.m3u8?token=abc" {
+		t.Errorf("uri %v", pl.Variants[0].Uri)
+	}
+}
+
+func TestParseMasterErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		line  int // of the ParseError, -1 for a PlaylistTypeError
+	}{
+		{"empty", "", 1},
+		{"no header", "#EXTM3\n", 1},
+		{"missing bandwidth", "#EXTM3U\n#EXT-X-STREAM-INF:RESOLUTION=1x1\nx.m3u8\n", 2},
+		{"variant without uri", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n", 2},
+		{"two variants without uri", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n#EXT-X-STREAM-INF:BANDWIDTH=2\nx.m3u8\n", 2},
+		{"uri without variant", "#EXTM3U\nx.m3u8\n", 2},
+		{"unterminated string", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,CODECS=\"avc1\nx.m3u8\n", 2},
+		{"unquoted string", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,CODECS=avc1\nx.m3u8\n", 2},
+		{"empty attribute", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,,X=1\nx.m3u8\n", 2},
+		{"duplicate attribute", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,BANDWIDTH=2\nx.m3u8\n", 2},
+		{"invalid resolution", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,RESOLUTION=1920\nx.m3u8\n", 2},
+		{"invalid frame rate", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,FRAME-RATE=NaN\nx.m3u8\n", 2},
+		{"invalid default", "#EXTM3U\n#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"a\",NAME=\"a\",DEFAULT=MAYBE\n", 2},
+		{"invalid version", "#EXTM3U\n#EXT-X-VERSION:0\n", 2},
+		{"media playlist", "#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXTINF:1,\nx.ts\n", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMaster([]byte(tt.input), "")
+			checkParseError(t, err, tt.line, "master")
+		})
+	}
+}
+
+func checkParseError(t *testing.T, err error, line int, playlistType string) {
+	t.Helper()
+	if line < 0 {
+		var typeErr *PlaylistTypeError
+		if !errors.As(err, &typeErr) || typeErr.Expected != playlistType {
+			t.Errorf("expected a PlaylistTypeError, got %v", err)
+		}
+		return
+	}
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected a ParseError, got %v", err)
+	}
+	if parseErr.Line != line {
+		t.Errorf("error at line %v instead of %v: %v", parseErr.Line, line, err)
+	}
+}
+
+const testMedia = `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-TARGETDURATION:8
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-DISCONTINUITY-SEQUENCE:3
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x1
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="100@0"
+#EXT-X-PROGRAM-DATE-TIME:2025-01-02T03:04:05.000Z
+#EXTINF:8.000,first
+#EXT-X-BYTERANGE:1000@100
+seg.ts
+#EXTINF:7.5,
+#EXT-X-BYTERANGE:500
+seg.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:8,
+/abs/seg2.ts
+#EXT-X-ENDLIST
+`
+
+func TestParseMedia(t *testing.T) {
+	pl, err := ParseMedia([]byte(testMedia), "https://cdn.example/v/1080p60/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pl.Version != 4 || pl.TargetDuration != 8*time.Second || pl.MediaSequence != 100 || pl.DiscontinuitySequence != 3 {
+		t.Errorf("header %+v", pl)
+	}
+	if pl.PlaylistType != PlaylistTypeEvent || !pl.EndList {
+		t.Errorf("type %v, endlist %v", pl.PlaylistType, pl.EndList)
+	}
+	if len(pl.Segments) != 3 {
+		t.Fatalf("%v segments instead of 3", len(pl.Segments))
+	}
+	tests := []struct {
+		uri       string
+		duration  time.Duration
+		title     string
+		byteRange *ByteRange
+		encrypted bool
+		disc      bool
+		date      string
+	}{
+		{"https://cdn.example/v/1080p60/seg.ts", 8 * time.Second, "first", &ByteRange{Length: 1000, Offset: 100}, true, false, "2025-01-02T03:04:05Z"},
+		{"https://cdn.example/v/1080p60/seg.ts", 7500 * time.Millisecond, "", &ByteRange{Length: 500, Offset: 1100}, true, false, "2025-01-02T03:04:13Z"},
+		{"https://cdn.example/abs/seg2.ts", 8 * time.Second, "", nil, false, true, "2025-01-02T03:04:20.5Z"},
+	}
+	for i, tt := range tests {
+		s := pl.Segments[i]
+		if s.Uri != tt.uri || s.Duration != tt.duration || s.Title != tt.title || s.SequenceNumber != int64(100+i) || s.Discontinuity != tt.disc {
+			t.Errorf("segment %v: %+v", i, s)
+		}
+		if (s.ByteRange == nil) != (tt.byteRange == nil) || (s.ByteRange != nil && *s.ByteRange != *tt.byteRange) {
+			t.Errorf("segment %v: byte range %+v instead of %+v", i, s.ByteRange, tt.byteRange)
+		}
+		if (s.Key != nil) != tt.encrypted {
+			t.Errorf("segment %v: key %+v", i, s.Key)
+		}
+		if date, _ := time.Parse(time.RFC3339Nano, tt.date); !s.ProgramDateTime.Equal(date) {
+			t.Errorf("segment %v: program date time %v instead of %v", i, s.ProgramDateTime, date)
+		}
+		if s.Map == nil || s.Map.Uri != "https://cdn.example/v/1080p60/init.mp4" || *s.Map.ByteRange != (ByteRange{Length: 100}) {
+			t.Errorf("segment %v: map %+v", i, s.Map)
+		}
+	}
+	key := pl.Segments[0].Key
+	if key.Method != KeyMethodAes128 || key.Uri != "https://cdn.example/v/1080p60/key.bin" {
+		t.Errorf("key %+v", key)
+	}
+	// left-padded to 128 bits
+	if !bytes.Equal(key.Iv, append(make([]byte, 15), 1)) {
+		t.Errorf("iv %x", key.Iv)
+	}
+}
+
+func TestParseMediaKeyWithoutIv(t *testing.T) {
+	pl, err := ParseMedia([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"k\",KEYFORMAT=\"com.apple.streamingkeydelivery\"\n#EXTINF:2,\nx.ts\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := pl.Segments[0].Key
+	if key.Method != KeyMethodSampleAes || key.Uri != "k" || key.Iv != nil || key.KeyFormat != "com.apple.streamingkeydelivery" {
+		t.Errorf("key %+v", key)
+	}
+	if pl.EndList || pl.PlaylistType != "" {
+		t.Errorf("endlist %v, type %v", pl.EndList, pl.PlaylistType)
+	}
+}
+
+func TestParseMediaErrors(t *testing.T) {
+	const header = "#EXTM3U\n#EXT-X-TARGETDURATION:2\n"
+	tests := []struct {
+		name  string
+		input string
+		line  int // of the ParseError, 0 if it isn't about a line, -1 for a PlaylistTypeError
+	}{
+		{"no header", "#EXT-X-TARGETDURATION:2\n", 1},
+		{"no target duration", "#EXTM3U\n#EXTINF:1,\nx.ts\n", 0},
+		{"invalid target duration", "#EXTM3U\n#EXT-X-TARGETDURATION:two\n", 2},
+		{"invalid duration", header + "#EXTINF:abc,\nx.ts\n", 3},
+		{"negative duration", header + "#EXTINF:-1,\nx.ts\n", 3},
+		{"uri without extinf", header + "x.ts\n", 3},
+		{"extinf without uri", header + "#EXTINF:1,\n", 0},
+		{"key without uri", header + "#EXT-X-KEY:METHOD=AES-128\n", 3},
+		{"key none with uri", header + "#EXT-X-KEY:METHOD=NONE,URI=\"k\"\n", 3},
+		{"iv too long", header + "#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x" + "00112233445566778899aabbccddeeff00" + "\n", 3},
+		{"invalid iv", header + "#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=12\n", 3},
+		{"byte range without previous range", header + "#EXT-X-BYTERANGE:5\n#EXTINF:1,\nx.ts\n", 5},
+		{"invalid byte range", header + "#EXT-X-BYTERANGE:5@x\n#EXTINF:1,\nx.ts\n", 3},
+		{"map byte range without offset", header + "#EXT-X-MAP:URI=\"i.mp4\",BYTERANGE=\"100\"\n", 3},
+		{"media sequence after segment", header + "#EXTINF:1,\nx.ts\n#EXT-X-MEDIA-SEQUENCE:5\n", 5},
+		{"invalid media sequence", header + "#EXT-X-MEDIA-SEQUENCE:-1\n", 3},
+		{"invalid playlist type", header + "#EXT-X-PLAYLIST-TYPE:LIVE\n", 3},
+		{"invalid date", header + "#EXT-X-PROGRAM-DATE-TIME:yesterday\n", 3},
+		{"master playlist", header + "#EXT-X-STREAM-INF:BANDWIDTH=1\nx.m3u8\n", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMedia([]byte(tt.input), "")
+			checkParseError(t, err, tt.line, "media")
+		})
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Attributes // nil if invalid
+	}{
+		{`A=1`, Attributes{"A": "1"}},
+		{`A=1,B="x,y",C=0x1F,D=1.5`, Attributes{"A": "1", "B": `"x,y"`, "C": "0x1F", "D": "1.5"}},
+		{`A-B=YES`, Attributes{"A-B": "YES"}},
+		{``, Attributes{}},
+		{`a=1`, nil},
+		{`A`, nil},
+		{`A=`, nil},
+		{`A=1,`, nil},
+		{`A="1`, nil},
+		{`A="1"B=2`, nil},
+		{`A=1,A=2`, nil},
+	}
+	for _, tt := range tests {
+		attrs, err := ParseAttributes(tt.input)
+		if tt.want == nil {
+			var attrErr *AttributeError
+			if !errors.As(err, &attrErr) {
+				t.Errorf("%q: expected an AttributeError, got %v", tt.input, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if len(attrs) != len(tt.want) {
+			t.Errorf("%q: %v instead of %v", tt.input, attrs, tt.want)
+		}
+		for name, value := range tt.want {
+			if attrs[name] != value {
+				t.Errorf("%q: %v=%v instead of %v", tt.input, name, attrs[name], value)
+			}
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Matroska element IDs
+const (
+	mkvIdEbml              = 0x1a45dfa3
+	mkvIdEbmlVersion       = 0x4286
+	mkvIdEbmlReadVersion   = 0x42f7
+	mkvIdEbmlMaxIdLength   = 0x42f2
+	mkvIdEbmlMaxSizeLength = 0x42f3
+	mkvIdDocType           = 0x4282
+	mkvIdDocTypeVersion    = 0x4287
+	mkvIdDocTypeReadVer    = 0x4285
+	mkvIdSegment           = 0x18538067
+	mkvIdSeekHead          = 0x114d9b74
+	mkvIdSeek              = 0x4dbb
+	mkvIdSeekId            = 0x53ab
+	mkvIdSeekPosition      = 0x53ac
+	mkvIdInfo              = 0x1549a966
+	mkvIdTimestampScale    = 0x2ad7b1
+	mkvIdMuxingApp         = 0x4d80
+	mkvIdWritingApp        = 0x5741
+	mkvIdDuration          = 0x4489
+	mkvIdTracks            = 0x1654ae6b
+	mkvIdTrackEntry        = 0xae
+	mkvIdTrackNumber       = 0xd7
+	mkvIdTrackUid          = 0x73c5
+	mkvIdTrackType         = 0x83
+	mkvIdFlagLacing        = 0x9c
+	mkvIdLanguage          = 0x22b59c
+	mkvIdCodecId           = 0x86
+	mkvIdCodecPrivate      = 0x63a2
+	mkvIdVideo             = 0xe0
+	mkvIdPixelWidth        = 0xb0
+	mkvIdPixelHeight       = 0xba
+	mkvIdAudio             = 0xe1
+	mkvIdSamplingFrequency = 0xb5
+	mkvIdChannels          = 0x9f
+	mkvIdCluster           = 0x1f43b675
+	mkvIdTimestamp         = 0xe7
+	mkvIdSimpleBlock       = 0xa3
+	mkvIdCues              = 0x1c53bb6b
+	mkvIdCuePoint          = 0xbb
+	mkvIdCueTime           = 0xb3
+	mkvIdCueTrackPositions = 0xb7
+	mkvIdCueTrack          = 0xf7
+	mkvIdCueClusterPos     = 0xf1
+)
+
+const mkvTimestampScale = 1_000_000 // 1 ms
+const mkvSeekHeadSize = 100         // reserved, the seek head is written at the end
+const mkvMaxClusterDuration = 5000  // in ms, if there is no video track
+const mkvMaxPendingFrames = 1000    // frames to buffer until all tracks are configured
+
+type mkvCue struct {
+	time  int64
+	track uint64
+	pos   int64
+}
+
+// Remuxes an MPEG transport stream with H.264 video and AAC audio into
+// a Matroska file. The transport stream is written to the remuxer, the
+// file is finished by Close.
+type MkvRemuxer struct {
+	w      io.WriteSeeker
+	frames *tsFrameReader
+	pos    int64
+	err    error
+	// buffered until the codec configuration of all tracks is known
+	pending       []*mediaFrame
+	headerWritten bool
+	trackNumbers  map[*mediaTrack]uint64
+	hasVideo      bool
+	// positions in the file
+	segmentSizePos int64
+	segmentPos     int64 // start of the segment data, positions in the seek head and cues are relative to this
+	seekHeadPos    int64
+	infoPos        int64
+	tracksPos      int64
+	durationPos    int64
+	// 90 kHz timestamps
+	base int64
+	end  int64
+	// the current cluster
+	cluster     []byte
+	clusterTime int64 // in ms
+	clusterCue  bool
+	hasCluster  bool
+	cues        []mkvCue
+}
+
+func NewMkvRemuxer(w io.WriteSeeker) *MkvRemuxer {
+	m := &MkvRemuxer{w: w, trackNumbers: map[*mediaTrack]uint64{}}
+	m.pos, m.err = w.Seek(0, io.SeekCurrent)
+	m.frames = newTsFrameReader(m.addFrame)
+	return m
+}
+
+func (m *MkvRemuxer) Write(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.frames.Write(p)
+	if m.err != nil {
+		return 0, m.err
+	}
+	return len(p), nil
+}
+
+// Write the remaining frames, the cues and the seek head
+func (m *MkvRemuxer) Close() error {
+	m.frames.flush()
+	if !m.headerWritten {
+		if len(m.pending) == 0 {
+			return &TsParseError{Msg: "no H.264 video or AAC audio found"}
+		}
+		m.writeHeader()
+	}
+	m.flushCluster()
+	if m.err != nil {
+		return m.err
+	}
+	seeks := [][]byte{
+		mkvSeek(mkvIdInfo, m.infoPos),
+		mkvSeek(mkvIdTracks, m.tracksPos),
+	}
+	if len(m.cues) > 0 {
+		seeks = append(seeks, mkvSeek(mkvIdCues, m.pos-m.segmentPos))
+		cuePoints := make([][]byte, 0, len(m.cues))
+		for _, c := range m.cues {
+			cuePoints = append(cuePoints, ebmlElement(mkvIdCuePoint,
+				ebmlUint(mkvIdCueTime, uint64(c.time)),
+				ebmlElement(mkvIdCueTrackPositions,
+					ebmlUint(mkvIdCueTrack, c.track),
+					ebmlUint(mkvIdCueClusterPos, uint64(c.pos)))))
+		}
+		m.write(ebmlElement(mkvIdCues, cuePoints...))
+	}
+	end := m.pos
+	seekHead := ebmlElement(mkvIdSeekHead, seeks...)
+	seekHead = append(seekHead, ebmlVoid(mkvSeekHeadSize-len(seekHead))...)
+	m.writeAt(seekHead, m.seekHeadPos)
+	m.writeAt(ebmlSizeFixed(uint64(end-m.segmentPos), 8), m.segmentSizePos)
+	duration := float64(m.end-m.base) / tsClockRate * 1000
+	m.writeAt(binary.BigEndian.AppendUint64(nil, math.Float64bits(duration)), m.durationPos)
+	if m.err == nil {
+		_, m.err = m.w.Seek(end, io.SeekStart)
+	}
+	return m.err
+}
+
+func mkvSeek(id uint32, pos int64) []byte {
+	return ebmlElement(mkvIdSeek,
+		ebmlElement(mkvIdSeekId, ebmlId(id)),
+		ebmlUintFixed(mkvIdSeekPosition, uint64(pos)))
+}
+
+func (m *MkvRemuxer) write(b []byte) {
+	if m.err != nil {
+		return
+	}
+	var n int
+	n, m.err = m.w.Write(b)
+	m.pos += int64(n)
+}
+
+func (m *MkvRemuxer) writeAt(b []byte, pos int64) {
+	if m.err != nil {
+		return
+	}
+	_, m.err = m.w.Seek(pos, io.SeekStart)
+	if m.err == nil {
+		_, m.err = m.w.Write(b)
+	}
+}
+
+func (m *MkvRemuxer) addFrame(f *mediaFrame) {
+	if m.headerWritten {
+		m.writeFrame(f)
+		return
+	}
+	m.pending = append(m.pending, f)
+	if m.frames.allConfigured() || len(m.pending) > mkvMaxPendingFrames {
+		m.writeHeader()
+	}
+}
+
+func (m *MkvRemuxer) writeHeader() {
+	m.headerWritten = true
+	// only tracks with a known configuration can be written
+	tracks := []*mediaTrack{}
+	m.base = math.MaxInt64
+	for _, f := range m.pending {
+		if _, ok := m.trackNumbers[f.track]; !ok && f.track.configured {
+			tracks = append(tracks, f.track)
+			m.trackNumbers[f.track] = uint64(len(tracks))
+		}
+		m.base = min(m.base, f.dts)
+	}
+	m.end = m.base
+	m.write(ebmlElement(mkvIdEbml,
+		ebmlUint(mkvIdEbmlVersion, 1),
+		ebmlUint(mkvIdEbmlReadVersion, 1),
+		ebmlUint(mkvIdEbmlMaxIdLength, 4),
+		ebmlUint(mkvIdEbmlMaxSizeLength, 8),
+		ebmlString(mkvIdDocType, "matroska"),
+		ebmlUint(mkvIdDocTypeVersion, 4),
+		ebmlUint(mkvIdDocTypeReadVer, 2)))
+	// the size of the segment is written at the end
+	m.write(ebmlId(mkvIdSegment))
+	m.segmentSizePos = m.pos
+	m.write(ebmlSizeFixed(0, 8))
+	m.segmentPos = m.pos
+	m.seekHeadPos = m.pos
+	m.write(ebmlVoid(mkvSeekHeadSize))
+	m.infoPos = m.pos - m.segmentPos
+	info := ebmlElement(mkvIdInfo,
+		ebmlUint(mkvIdTimestampScale, mkvTimestampScale),
+		ebmlString(mkvIdMuxingApp, "lurch-dl"),
+		ebmlString(mkvIdWritingApp, "lurch-dl "+ToolVersion),
+		ebmlFloat(mkvIdDuration, 0))
+	// the duration is the last element
+	m.durationPos = m.pos + int64(len(info)) - 8
+	m.write(info)
+	m.tracksPos = m.pos - m.segmentPos
+	entries := [][]byte{}
+	for _, t := range tracks {
+		entries = append(entries, m.trackEntry(t))
+	}
+	m.write(ebmlElement(mkvIdTracks, entries...))
+	pending := m.pending
+	m.pending = nil
+	for _, f := range pending {
+		m.writeFrame(f)
+	}
+}
+
+func (m *MkvRemuxer) trackEntry(t *mediaTrack) []byte {
+	n := m.trackNumbers[t]
+	common := [][]byte{
+		ebmlUint(mkvIdTrackNumber, n),
+		ebmlUint(mkvIdTrackUid, n),
+		ebmlUint(mkvIdFlagLacing, 0),
+		ebmlString(mkvIdLanguage, "und"),
+	}
+	if t.video {
+		m.hasVideo = true
+		codecId := "V_MPEG4/ISO/AVC"
+		if t.hevc {
+			codecId = "V_MPEGH/ISO/HEVC"
+		}
+		return ebmlElement(mkvIdTrackEntry, append(common,
+			ebmlUint(mkvIdTrackType, 1),
+			ebmlString(mkvIdCodecId, codecId),
+			ebmlElement(mkvIdCodecPrivate, t.decoderConfig()),
+			ebmlElement(mkvIdVideo,
+				ebmlUint(mkvIdPixelWidth, uint64(t.width)),
+				ebmlUint(mkvIdPixelHeight, uint64(t.height))))...)
+	}
+	return ebmlElement(mkvIdTrackEntry, append(common,
+		ebmlUint(mkvIdTrackType, 2),
+		ebmlString(mkvIdCodecId, "A_AAC"),
+		ebmlElement(mkvIdCodecPrivate, t.audioConfig),
+		ebmlElement(mkvIdAudio,
+			ebmlFloat(mkvIdSamplingFrequency, float64(t.sampleRate)),
+			ebmlUint(mkvIdChannels, uint64(t.channels))))...)
+}
+
+func (m *MkvRemuxer) writeFrame(f *mediaFrame) {
+	n, ok := m.trackNumbers[f.track]
+	if !ok {
+		return
+	}
+	t := (f.pts - m.base) * 1000 / tsClockRate
+	m.end = max(m.end, f.pts+f.duration)
+	startCluster := !m.hasCluster ||
+		(f.track.video && f.keyframe) ||
+		(!m.hasVideo && t-m.clusterTime >= mkvMaxClusterDuration) ||
+		t-m.clusterTime > math.MaxInt16 || t-m.clusterTime < math.MinInt16
+	if startCluster {
+		m.flushCluster()
+		m.hasCluster = true
+		m.clusterTime = max(t, 0)
+		// seek to video keyframes, or to any cluster if there is no video
+		m.clusterCue = f.track.video || !m.hasVideo
+		if m.clusterCue {
+			m.cues = append(m.cues, mkvCue{time: m.clusterTime, track: n})
+		}
+		m.cluster = ebmlUint(mkvIdTimestamp, uint64(m.clusterTime))
+	}
+	data := f.data
+	if f.track.video {
+		data = f.track.lengthPrefixed(data)
+	}
+	var flags byte
+	if f.keyframe {
+		flags |= 0x80
+	}
+	block := append(ebmlSize(n), 0, 0, flags)
+	binary.BigEndian.PutUint16(block[len(block)-3:], uint16(int16(t-m.clusterTime)))
+	m.cluster = append(m.cluster, ebmlElement(mkvIdSimpleBlock, block, data)...)
+}
+
+func (m *MkvRemuxer) flushCluster() {
+	if !m.hasCluster {
+		return
+	}
+	if m.clusterCue {
+		m.cues[len(m.cues)-1].pos = m.pos - m.segmentPos
+	}
+	m.write(ebmlElement(mkvIdCluster, m.cluster))
+	m.hasCluster = false
+	m.cluster = nil
+}
+
+// Remux a complete MPEG transport stream into a Matroska file
+func RemuxTsToMkv(input io.Reader, output io.WriteSeeker) error {
+	m := NewMkvRemuxer(output)
+	_, err := io.Copy(m, input)
+	if err != nil {
+		return err
+	}
+	return m.Close()
+}
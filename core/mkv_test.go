@@ -0,0 +1,219 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var testMkvMasterElements = []uint32{
+	mkvIdEbml, mkvIdSegment, mkvIdSeekHead, mkvIdSeek, mkvIdInfo, mkvIdTracks, mkvIdTrackEntry,
+	mkvIdVideo, mkvIdAudio, mkvIdCluster, mkvIdCues, mkvIdCuePoint, mkvIdCueTrackPositions,
+}
+
+type testEbmlElement struct {
+	id       uint32
+	pos      int // of the data, in the file
+	data     []byte
+	children []testEbmlElement
+}
+
+// Parse the elements in data, the sizes of all elements have to add up
+// exactly to the size of their parent
+func testParseEbml(t *testing.T, data []byte, pos int) []testEbmlElement {
+	t.Helper()
+	elements := []testEbmlElement{}
+	readVint := func(keepMarker bool) uint64 {
+		if len(data) == 0 || data[0] == 0 {
+			t.Fatalf("invalid variable size integer at %v", pos)
+		}
+		length := bits.LeadingZeros8(data[0]) + 1
+		if len(data) < length {
+			t.Fatalf("truncated variable size integer at %v", pos)
+		}
+		v := uint64(data[0])
+		if !keepMarker {
+			v &= 0xff >> length
+		}
+		for _, b := range data[1:length] {
+			v = v<<8 | uint64(b)
+		}
+		data, pos = data[length:], pos+length
+		return v
+	}
+	for len(data) > 0 {
+		id := uint32(readVint(true))
+		size := int(readVint(false))
+		if size > len(data) {
+			t.Fatalf("element %x at %v: size %v, %v bytes left", id, pos, size, len(data))
+		}
+		e := testEbmlElement{id: id, pos: pos, data: data[:size]}
+		if slices.Contains(testMkvMasterElements, id) {
+			e.children = testParseEbml(t, e.data, pos)
+		}
+		elements = append(elements, e)
+		data, pos = data[size:], pos+size
+	}
+	return elements
+}
+
+func (e *testEbmlElement) all(id uint32) []testEbmlElement {
+	found := []testEbmlElement{}
+	for _, c := range e.children {
+		if c.id == id {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+func (e *testEbmlElement) child(t *testing.T, id uint32) testEbmlElement {
+	t.Helper()
+	found := e.all(id)
+	if len(found) != 1 {
+		t.Fatalf("%v elements %x in %x", len(found), id, e.id)
+	}
+	return found[0]
+}
+
+func (e *testEbmlElement) uint() uint64 {
+	var v uint64
+	for _, b := range e.data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func (e *testEbmlElement) float() float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(e.data))
+}
+
+// Two chunks of 2 seconds with a keyframe every second
+func testTsInput(streamType uint8) []byte {
+	w := newTestTsWriter(streamType)
+	data := w.chunk(10*tsClockRate, 60, testKeyframes(0, 30))
+	return append(data, w.chunk(12*tsClockRate, 60, testKeyframes(0, 30))...)
+}
+
+func TestRemuxTsToMkv(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "test.mkv")
+	f, err := os.Create(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RemuxTsToMkv(bytes.NewReader(testTsInput(tsStreamTypeH264)), f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := testEbmlElement{children: testParseEbml(t, data, 0)}
+	file.child(t, mkvIdEbml)
+	segment := file.child(t, mkvIdSegment)
+	if len(file.children) != 2 {
+		t.Errorf("%v top level elements", len(file.children))
+	}
+	// positions relative to the segment data
+	positions := map[uint32]int{}
+	for _, e := range segment.children {
+		if _, ok := positions[e.id]; !ok {
+			positions[e.id] = e.pos - len(ebmlId(e.id)) - len(ebmlSize(uint64(len(e.data)))) - segment.pos
+		}
+	}
+	seekHead := segment.child(t, mkvIdSeekHead)
+	for _, seek := range seekHead.all(mkvIdSeek) {
+		id, pos := seek.child(t, mkvIdSeekId), seek.child(t, mkvIdSeekPosition)
+		if int(pos.uint()) != positions[uint32(id.uint())] {
+			t.Errorf("seek head: %x at %v instead of %v", id.uint(), pos.uint(), positions[uint32(id.uint())])
+		}
+	}
+	if n := len(seekHead.all(mkvIdSeek)); n != 3 {
+		t.Errorf("%v seek entries", n)
+	}
+	// tracks
+	info := segment.child(t, mkvIdInfo)
+	if d, ticks := info.child(t, mkvIdDuration), 180000+94*testAudioTicks; d.float() != float64(ticks)/90 {
+		t.Errorf("duration %v ms", d.float())
+	}
+	tracks := segment.child(t, mkvIdTracks)
+	entries := tracks.all(mkvIdTrackEntry)
+	if len(entries) != 2 {
+		t.Fatalf("%v tracks", len(entries))
+	}
+	// in the order their first frame was complete, video first here
+	if trackType := entries[0].child(t, mkvIdTrackType); trackType.uint() != 1 {
+		slices.Reverse(entries)
+	}
+	videoNumber, audioNumber := entries[0].child(t, mkvIdTrackNumber), entries[1].child(t, mkvIdTrackNumber)
+	video, audio := entries[0].child(t, mkvIdVideo), entries[1].child(t, mkvIdAudio)
+	videoCodec, audioCodec := entries[0].child(t, mkvIdCodecId), entries[1].child(t, mkvIdCodecId)
+	if string(videoCodec.data) != "V_MPEG4/ISO/AVC" || string(audioCodec.data) != "A_AAC" {
+		t.Errorf("codecs %q and %q", videoCodec.data, audioCodec.data)
+	}
+	if w, h := video.child(t, mkvIdPixelWidth), video.child(t, mkvIdPixelHeight); w.uint() != 320 || h.uint() != 240 {
+		t.Errorf("%vx%v", w.uint(), h.uint())
+	}
+	if rate, channels := audio.child(t, mkvIdSamplingFrequency), audio.child(t, mkvIdChannels); rate.float() != 48000 || channels.uint() != 2 {
+		t.Errorf("%v Hz, %v channels", rate.float(), channels.uint())
+	}
+	videoConfig, audioConfig := entries[0].child(t, mkvIdCodecPrivate), entries[1].child(t, mkvIdCodecPrivate)
+	if !bytes.Equal(videoConfig.data, avcDecoderConfig(testH264Sps, testH264Pps)) || !bytes.Equal(audioConfig.data, []byte{0x11, 0x90}) {
+		t.Errorf("codec private data % x and % x", videoConfig.data, audioConfig.data)
+	}
+	// a cluster per keyframe, with the blocks of both tracks. Audio
+	// frames before the first keyframe are in a cluster of their own.
+	clusters := []testEbmlElement{}
+	blocks := map[uint64]int{}
+	for _, cluster := range segment.all(mkvIdCluster) {
+		ts := cluster.child(t, mkvIdTimestamp)
+		for j, block := range cluster.all(mkvIdSimpleBlock) {
+			track, keyframe := uint64(block.data[0]&0x7f), block.data[3]&0x80 != 0
+			if j == 0 && track == videoNumber.uint() {
+				if !keyframe || block.data[1] != 0 || block.data[2] != 0 || ts.uint() != uint64(len(clusters)*1000) {
+					t.Errorf("cluster at %v ms doesn't start with a keyframe: % x", ts.uint(), block.data[:4])
+				}
+				clusters = append(clusters, cluster)
+			}
+			blocks[track]++
+		}
+	}
+	if len(clusters) != 4 {
+		t.Fatalf("%v clusters with video", len(clusters))
+	}
+	if blocks[videoNumber.uint()] != 120 || blocks[audioNumber.uint()] != 2*94 {
+		t.Errorf("%v video and %v audio blocks", blocks[videoNumber.uint()], blocks[audioNumber.uint()])
+	}
+	// the cues point to the clusters
+	cues := segment.child(t, mkvIdCues)
+	for i, cuePoint := range cues.all(mkvIdCuePoint) {
+		positions := cuePoint.child(t, mkvIdCueTrackPositions)
+		pos := positions.child(t, mkvIdCueClusterPos)
+		if cluster := clusters[i]; int(pos.uint()) != cluster.pos-4-len(ebmlSize(uint64(len(cluster.data))))-segment.pos {
+			t.Errorf("cue %v points to %v", i, pos.uint())
+		}
+	}
+	if n := len(cues.all(mkvIdCuePoint)); n != 4 {
+		t.Errorf("%v cue points", n)
+	}
+}
+
+func TestRemuxTsToMkvNoStreams(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := RemuxTsToMkv(bytes.NewReader(nil), f); err == nil {
+		t.Error("an empty input was remuxed")
+	}
+}
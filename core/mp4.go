@@ -0,0 +1,150 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// Helpers to write ISO base media file format (MP4) boxes
+
+func mp4Box(boxType string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := binary.BigEndian.AppendUint32(make([]byte, 0, size), uint32(size))
+	b = append(b, boxType...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func mp4FullBox(boxType string, version byte, flags uint32, payload ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return mp4Box(boxType, append([][]byte{header}, payload...)...)
+}
+
+// Big endian fields
+func be16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func be32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func be64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+var mp4UnityMatrix = []byte{
+	0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0,
+}
+
+const mp4MovieTimescale = 1000
+
+// A track of an MP4 file
+type mp4Track struct {
+	id        uint32
+	timescale uint32
+	media     *mediaTrack
+}
+
+func mp4Ftyp() []byte {
+	return mp4Box("ftyp", []byte("iso6"), be32(0), []byte("iso6cmfcisomavc1mp41"))
+}
+
+func mp4Mvhd(duration uint64, nextTrackId uint32) []byte {
+	return mp4FullBox("mvhd", 1, 0,
+		be64(0), be64(0), // creation and modification time
+		be32(mp4MovieTimescale), be64(duration),
+		be32(0x00010000), be16(0x0100), make([]byte, 10), // rate, volume, reserved
+		mp4UnityMatrix, make([]byte, 24), be32(nextTrackId))
+}
+
+func mp4Trak(t *mp4Track) []byte {
+	var volume uint16
+	var width, height uint32
+	var handler, handlerName string
+	var mediaHeader []byte
+	if t.media.video {
+		width, height = uint32(t.media.width), uint32(t.media.height)
+		handler, handlerName = "vide", "VideoHandler"
+		mediaHeader = mp4FullBox("vmhd", 0, 1, make([]byte, 8))
+	} else {
+		volume = 0x0100
+		handler, handlerName = "soun", "SoundHandler"
+		mediaHeader = mp4FullBox("smhd", 0, 0, make([]byte, 4))
+	}
+	tkhd := mp4FullBox("tkhd", 1, 3, // enabled, in movie
+		be64(0), be64(0), be32(t.id), be32(0), be64(0), // times, track id, reserved, duration
+		make([]byte, 8), be16(0), be16(0), be16(volume), be16(0), // reserved, layer, alternate group, volume, reserved
+		mp4UnityMatrix, be32(width<<16), be32(height<<16))
+	mdhd := mp4FullBox("mdhd", 1, 0,
+		be64(0), be64(0), be32(t.timescale), be64(0),
+		be16(0x55c4), be16(0)) // language "und"
+	hdlr := mp4FullBox("hdlr", 0, 0,
+		be32(0), []byte(handler), make([]byte, 12), []byte(handlerName+"\x00"))
+	dinf := mp4Box("dinf", mp4FullBox("dref", 0, 0, be32(1), mp4FullBox("url ", 0, 1)))
+	stbl := mp4Box("stbl",
+		mp4FullBox("stsd", 0, 0, be32(1), mp4SampleEntry(t.media)),
+		mp4FullBox("stts", 0, 0, be32(0)),
+		mp4FullBox("stsc", 0, 0, be32(0)),
+		mp4FullBox("stsz", 0, 0, be32(0), be32(0)),
+		mp4FullBox("stco", 0, 0, be32(0)))
+	return mp4Box("trak", tkhd, mp4Box("mdia", mdhd, hdlr, mp4Box("minf", mediaHeader, dinf, stbl)))
+}
+
+func mp4SampleEntry(t *mediaTrack) []byte {
+	if t.video {
+		sampleEntry, configBox := "avc1", "avcC"
+		if t.hevc {
+			sampleEntry, configBox = "hvc1", "hvcC"
+		}
+		return mp4Box(sampleEntry,
+			make([]byte, 6), be16(1), // reserved, data reference index
+			make([]byte, 16), be16(uint16(t.width)), be16(uint16(t.height)),
+			be32(0x00480000), be32(0x00480000), be32(0), be16(1), // resolution, reserved, frame count
+			make([]byte, 32), be16(0x0018), be16(0xffff), // compressor name, depth, pre-defined
+			mp4Box(configBox, t.decoderConfig()))
+	}
+	return mp4Box("mp4a",
+		make([]byte, 6), be16(1),
+		make([]byte, 8), be16(uint16(t.channels)), be16(16), be32(0),
+		be32(uint32(t.sampleRate)<<16),
+		mp4Esds(t.audioConfig))
+}
+
+// Elementary stream descriptor (ISO/IEC 14496-1) for AAC
+func mp4Esds(audioConfig []byte) []byte {
+	descriptor := func(tag byte, payload ...[]byte) []byte {
+		b := []byte{tag, 0}
+		for _, p := range payload {
+			b = append(b, p...)
+		}
+		b[1] = byte(len(b) - 2)
+		return b
+	}
+	decoderConfig := descriptor(0x04,
+		[]byte{0x40, 0x15},                // MPEG-4 audio, audio stream
+		make([]byte, 3), be32(0), be32(0), // buffer size, max and average bitrate
+		descriptor(0x05, audioConfig))
+	return mp4FullBox("esds", 0, 0,
+		descriptor(0x03, be16(0), []byte{0}, decoderConfig, descriptor(0x06, []byte{0x02})))
+}
+
+type mp4Chapter struct {
+	start time.Duration // from the start of the file
+	title string
+}
+
+// Nero chapter list, supported by most players
+func mp4Chpl(chapters []mp4Chapter) []byte {
+	chapters = chapters[:min(len(chapters), 255)]
+	b := []byte{0, 0, 0, 0, byte(len(chapters))} // reserved, count
+	for _, c := range chapters {
+		title := strings.ToValidUTF8(c.title[:min(len(c.title), 255)], "")
+		b = binary.BigEndian.AppendUint64(b, uint64(c.start/100)) // in 100 ns
+		b = append(b, byte(len(title)))
+		b = append(b, title...)
+	}
+	return mp4FullBox("chpl", 1, 0, b)
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import "sort"
+
+// A minimal MPEG transport stream demuxer (ISO/IEC 13818-1)
+
+const tsPacketSize = 188
+const tsSyncByte = 0x47
+const tsPidPat = 0x0000
+const tsPtsWrap = 1 << 33
+const tsClockRate = 90000 // PTS/DTS ticks per second
+
+// Stream types in the PMT
+const (
+	tsStreamTypeAac  = 0x0f
+	tsStreamTypeH264 = 0x1b
+	tsStreamTypeHevc = 0x24
+)
+
+type tsPacket struct {
+	pid           uint16
+	pusi          bool // payload unit start indicator
+	cc            uint8
+	hasPayload    bool
+	discontinuity bool
+	randomAccess  bool
+	payload       []byte
+}
+
+func parseTsPacket(b []byte) (tsPacket, error) {
+	p := tsPacket{}
+	if len(b) < tsPacketSize {
+		return p, &TsParseError{Msg: "packet too short"}
+	}
+	if b[0] != tsSyncByte {
+		return p, &TsParseError{Msg: "sync byte missing"}
+	}
+	p.pusi = b[1]&0x40 != 0
+	p.pid = uint16(b[1]&0x1f)<<8 | uint16(b[2])
+	adaptationFieldControl := (b[3] >> 4) & 0x03
+	p.cc = b[3] & 0x0f
+	offset := 4
+	if adaptationFieldControl&0x02 != 0 {
+		length := int(b[4])
+		if 5+length > tsPacketSize {
+			return p, &TsParseError{Msg: "adaptation field too long"}
+		}
+		if length > 0 {
+			p.discontinuity = b[5]&0x80 != 0
+			p.randomAccess = b[5]&0x40 != 0
+		}
+		offset = 5 + length
+	}
+	if adaptationFieldControl&0x01 != 0 && offset < tsPacketSize {
+		p.hasPayload = true
+		p.payload = b[offset:tsPacketSize]
+	}
+	return p, nil
+}
+
+// A PES packet, including the indices of the TS packets it consists of
+type pesUnit struct {
+	pid          uint16
+	streamType   uint8
+	pts          int64 // -1 if missing
+	dts          int64 // -1 if missing, otherwise equal to pts
+	randomAccess bool
+	complete     bool // false if the beginning of the PES packet is missing
+	data         []byte // elementary stream data, without the PES header
+	packets      []int
+}
+
+// The DTS if available, else the PTS
+func (u *pesUnit) decodeTime() int64 {
+	if u.dts >= 0 {
+		return u.dts
+	}
+	return u.pts
+}
+
+func readPesTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+// Returns the PTS, DTS and the length of the header
+func parsePesHeader(b []byte) (int64, int64, int, error) {
+	if len(b) < 9 || b[0] != 0 || b[1] != 0 || b[2] != 1 {
+		return -1, -1, 0, &TsParseError{Msg: "invalid PES header"}
+	}
+	headerLen := 9 + int(b[8])
+	if len(b) < headerLen {
+		return -1, -1, 0, &TsParseError{Msg: "PES header too short"}
+	}
+	pts := int64(-1)
+	dts := int64(-1)
+	flags := b[7] >> 6
+	if flags&0x02 != 0 && headerLen >= 14 {
+		pts = readPesTimestamp(b[9:14])
+		dts = pts
+	}
+	if flags == 0x03 && headerLen >= 19 {
+		dts = readPesTimestamp(b[14:19])
+	}
+	return pts, dts, headerLen, nil
+}
+
+// The signed difference a - b of two 33 bit timestamps
+func ptsDelta(a int64, b int64) int64 {
+	d := (a - b) & (tsPtsWrap - 1)
+	if d >= tsPtsWrap/2 {
+		d -= tsPtsWrap
+	}
+	return d
+}
+
+type tsDemuxer struct {
+	streams  map[uint16]uint8 // elementary stream PID -> stream type
+	pmtPids  map[uint16]bool
+	sections map[uint16][]byte
+	units    map[uint16]*pesUnit
+	packets  int
+	onPes    func(*pesUnit)
+}
+
+// onPes is called for every PES packet, in order per PID
+func newTsDemuxer(onPes func(*pesUnit)) *tsDemuxer {
+	return &tsDemuxer{
+		streams:  map[uint16]uint8{},
+		pmtPids:  map[uint16]bool{},
+		sections: map[uint16][]byte{},
+		units:    map[uint16]*pesUnit{},
+		onPes:    onPes,
+	}
+}
+
+// Process the next TS packet
+func (d *tsDemuxer) push(b []byte) error {
+	idx := d.packets
+	d.packets++
+	p, err := parseTsPacket(b)
+	if err != nil {
+		return err
+	}
+	if p.pid == tsPidPat || d.pmtPids[p.pid] {
+		d.pushSection(p)
+		return nil
+	}
+	streamType, ok := d.streams[p.pid]
+	if !ok {
+		return nil
+	}
+	u := d.units[p.pid]
+	if p.pusi {
+		if u != nil {
+			d.emit(u)
+		}
+		u = &pesUnit{pid: p.pid, streamType: streamType, pts: -1, dts: -1, randomAccess: p.randomAccess, complete: true}
+		d.units[p.pid] = u
+	} else if u == nil {
+		// the beginning of this PES packet is missing
+		u = &pesUnit{pid: p.pid, streamType: streamType, pts: -1, dts: -1}
+		d.units[p.pid] = u
+	}
+	u.packets = append(u.packets, idx)
+	if p.hasPayload {
+		u.data = append(u.data, p.payload...)
+	}
+	return nil
+}
+
+// Emit the remaining PES packets
+func (d *tsDemuxer) flush() {
+	units := make([]*pesUnit, 0, len(d.units))
+	for _, u := range d.units {
+		units = append(units, u)
+	}
+	sort.Slice(units, func(i int, j int) bool {
+		return units[i].packets[0] < units[j].packets[0]
+	})
+	for _, u := range units {
+		d.emit(u)
+	}
+}
+
+func (d *tsDemuxer) emit(u *pesUnit) {
+	delete(d.units, u.pid)
+	if u.complete {
+		pts, dts, headerLen, err := parsePesHeader(u.data)
+		if err != nil {
+			u.complete = false
+		} else {
+			u.pts, u.dts = pts, dts
+			u.data = u.data[headerLen:]
+		}
+	}
+	d.onPes(u)
+}
+
+func (d *tsDemuxer) pushSection(p tsPacket) {
+	if !p.hasPayload {
+		return
+	}
+	if p.pusi {
+		pointer := int(p.payload[0])
+		if 1+pointer > len(p.payload) {
+			return
+		}
+		d.sections[p.pid] = append([]byte{}, p.payload[1+pointer:]...)
+	} else if buf, ok := d.sections[p.pid]; ok {
+		d.sections[p.pid] = append(buf, p.payload...)
+	} else {
+		return
+	}
+	buf := d.sections[p.pid]
+	if len(buf) < 3 {
+		return
+	}
+	sectionLen := int(buf[1]&0x0f)<<8 | int(buf[2])
+	if len(buf) < 3+sectionLen {
+		return // wait for the next packet
+	}
+	delete(d.sections, p.pid)
+	section := buf[:3+sectionLen]
+	if len(section) < 12 {
+		return
+	}
+	switch section[0] {
+	case 0x00:
+		d.parsePat(section)
+	case 0x02:
+		d.parsePmt(section)
+	}
+}
+
+func (d *tsDemuxer) parsePat(section []byte) {
+	// 8 bytes header, 4 bytes CRC at the end
+	for i := 8; i+4 <= len(section)-4; i += 4 {
+		programNumber := uint16(section[i])<<8 | uint16(section[i+1])
+		pid := uint16(section[i+2]&0x1f)<<8 | uint16(section[i+3])
+		if programNumber != 0 {
+			d.pmtPids[pid] = true
+		}
+	}
+}
+
+func (d *tsDemuxer) parsePmt(section []byte) {
+	programInfoLen := int(section[10]&0x0f)<<8 | int(section[11])
+	for i := 12 + programInfoLen; i+5 <= len(section)-4; {
+		streamType := section[i]
+		pid := uint16(section[i+1]&0x1f)<<8 | uint16(section[i+2])
+		esInfoLen := int(section[i+3]&0x0f)<<8 | int(section[i+4])
+		d.streams[pid] = streamType
+		i += 5 + esInfoLen
+	}
+}
+
+func isVideoStreamType(streamType uint8) bool {
+	return streamType == tsStreamTypeH264 || streamType == tsStreamTypeHevc
+}
+
+func isKeyframe(u *pesUnit) bool {
+	switch u.streamType {
+	case tsStreamTypeH264:
+		for nalu := range annexBNalUnits(u.data) {
+			if len(nalu) > 0 && nalu[0]&0x1f == h264NalIdr {
+				return true
+			}
+		}
+		return false
+	case tsStreamTypeHevc:
+		for nalu := range annexBNalUnits(u.data) {
+			if len(nalu) > 1 && isHevcIrap(nalu) {
+				return true
+			}
+		}
+		return false
+	default:
+		return u.randomAccess
+	}
+}
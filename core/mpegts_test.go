@@ -0,0 +1,229 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	testPmtPid     = 0x1000
+	testVideoPid   = 0x100
+	testAudioPid   = 0x101
+	testFrameTicks = 3000 // 30 fps
+	testAudioTicks = aacSamplesPerFrame * tsClockRate / 48000
+)
+
+var (
+	// 320x240, baseline profile
+	testH264Sps = []byte{0x67, 0x42, 0xc0, 0x1e, 0xda, 0x05, 0x07, 0xe4}
+	testH264Pps = []byte{0x68, 0xce, 0x38, 0x80}
+)
+
+// Writes a transport stream with a video (H.264 or HEVC) and an AAC
+// stream. The continuity counters continue across chunks.
+type testTsWriter struct {
+	videoStreamType uint8
+	data            []byte
+	cc              map[uint16]uint8
+}
+
+func newTestTsWriter(videoStreamType uint8) *testTsWriter {
+	return &testTsWriter{videoStreamType: videoStreamType, cc: map[uint16]uint8{}}
+}
+
+// CRC-32/MPEG-2 of PSI sections
+func testPsiCrc(b []byte) []byte {
+	crc := uint32(0xffffffff)
+	for _, c := range b {
+		crc ^= uint32(c) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return append(b, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+func (w *testTsWriter) header(pid uint16, pusi bool, adaptation bool) []byte {
+	b := []byte{tsSyncByte, byte(pid >> 8), byte(pid), 0x10 | w.cc[pid]}
+	if pusi {
+		b[1] |= 0x40
+	}
+	if adaptation {
+		b[3] |= 0x20
+	}
+	w.cc[pid] = (w.cc[pid] + 1) & 0x0f
+	return b
+}
+
+func (w *testTsWriter) section(pid uint16, section []byte) {
+	packet := append(w.header(pid, true, false), 0)
+	packet = append(packet, testPsiCrc(section)...)
+	w.data = append(w.data, packet...)
+	w.data = append(w.data, bytes.Repeat([]byte{0xff}, tsPacketSize-len(packet))...)
+}
+
+// Write the PAT and the PMT
+func (w *testTsWriter) psi() {
+	w.section(tsPidPat, []byte{
+		0x00, 0xb0, 13, 0x00, 0x01, 0xc1, 0x00, 0x00,
+		0x00, 0x01, 0xe0 | testPmtPid>>8, testPmtPid & 0xff,
+	})
+	w.section(testPmtPid, []byte{
+		0x02, 0xb0, 23, 0x00, 0x01, 0xc1, 0x00, 0x00,
+		0xe0 | testVideoPid>>8, testVideoPid & 0xff, 0xf0, 0x00,
+		w.videoStreamType, 0xe0 | testVideoPid>>8, testVideoPid & 0xff, 0xf0, 0x00,
+		tsStreamTypeAac, 0xe0 | testAudioPid>>8, testAudioPid & 0xff, 0xf0, 0x00,
+	})
+}
+
+// Split a PES packet into TS packets, the last one is filled up with
+// adaptation field stuffing
+func (w *testTsWriter) pes(pid uint16, streamId byte, pts int64, randomAccess bool, data []byte) {
+	pesLen := 0
+	if pid == testAudioPid {
+		pesLen = 8 + len(data)
+	}
+	payload := []byte{
+		0x00, 0x00, 0x01, streamId, byte(pesLen >> 8), byte(pesLen), 0x80, 0x80, 5,
+		0x21 | byte(pts>>29)&0x0e, byte(pts >> 22), 0x01 | byte(pts>>14), byte(pts >> 7), 0x01 | byte(pts<<1),
+	}
+	payload = append(payload, data...)
+	first := true
+	for len(payload) > 0 {
+		var adaptation []byte
+		if first && randomAccess {
+			adaptation = []byte{1, 0x40}
+		}
+		if stuffing := tsPacketSize - 4 - len(adaptation) - len(payload); stuffing > 0 {
+			switch {
+			case adaptation != nil:
+				adaptation[0] += byte(stuffing)
+			case stuffing == 1:
+				adaptation = []byte{0}
+				stuffing = 0
+			default:
+				adaptation = []byte{byte(stuffing - 1), 0x00}
+				stuffing -= 2
+			}
+			adaptation = append(adaptation, bytes.Repeat([]byte{0xff}, stuffing)...)
+		}
+		n := tsPacketSize - 4 - len(adaptation)
+		w.data = append(w.data, w.header(pid, first, adaptation != nil)...)
+		w.data = append(w.data, adaptation...)
+		w.data = append(w.data, payload[:n]...)
+		payload = payload[n:]
+		first = false
+	}
+}
+
+func (w *testTsWriter) video(pts int64, keyframe bool) {
+	var nalUnits [][]byte
+	if w.videoStreamType == tsStreamTypeHevc {
+		nalType := byte(1) // TRAIL_R
+		if keyframe {
+			nalType = 19 // IDR_W_RADL
+		}
+		nalUnits = [][]byte{{35 << 1, 0x01, 0x50}, {nalType << 1, 0x01, 0xaf, 0x12, 0x34}}
+	} else if keyframe {
+		nalUnits = [][]byte{{h264NalAud, 0x10}, testH264Sps, testH264Pps, {0x65, 0x88, 0x84, 0x21, 0xa0}}
+	} else {
+		nalUnits = [][]byte{{h264NalAud, 0x30}, {0x41, 0x9a, 0x02, 0x13, 0x0c}}
+	}
+	var data []byte
+	for _, nalu := range nalUnits {
+		data = append(data, 0x00, 0x00, 0x00, 0x01)
+		data = append(data, nalu...)
+	}
+	// a few more TS packets per frame
+	data = append(data, bytes.Repeat([]byte{0x5a}, 300)...)
+	w.pes(testVideoPid, 0xe0, pts, keyframe, data)
+}
+
+// One AAC LC frame, 48 kHz, stereo
+func (w *testTsWriter) audio(pts int64) {
+	frameLen := 7 + 20
+	frame := []byte{0xff, 0xf1, 0x4c, 0x80 | byte(frameLen>>11), byte(frameLen >> 3), byte(frameLen<<5) | 0x1f, 0xfc}
+	frame = append(frame, bytes.Repeat([]byte{0x21}, 20)...)
+	w.pes(testAudioPid, 0xc0, pts, true, frame)
+}
+
+// A chunk with frames video frames from base on and the audio frames in
+// between. keyframe reports if the video frame with the index i is one.
+func (w *testTsWriter) chunk(base int64, frames int, keyframe func(i int) bool) []byte {
+	w.data = nil
+	w.psi()
+	audioPts := base
+	for i := range frames {
+		pts := base + int64(i)*testFrameTicks
+		w.video(pts, keyframe(i))
+		for ; audioPts < pts+testFrameTicks; audioPts += testAudioTicks {
+			w.audio(audioPts)
+		}
+	}
+	return w.data
+}
+
+func testDemux(t *testing.T, data []byte) []*pesUnit {
+	t.Helper()
+	units := []*pesUnit{}
+	demuxer := newTsDemuxer(func(u *pesUnit) {
+		units = append(units, u)
+	})
+	for i := 0; i < len(data); i += tsPacketSize {
+		if err := demuxer.push(data[i : i+tsPacketSize]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	demuxer.flush()
+	return units
+}
+
+func TestTsDemuxer(t *testing.T) {
+	for _, streamType := range []uint8{tsStreamTypeH264, tsStreamTypeHevc} {
+		w := newTestTsWriter(streamType)
+		data := w.chunk(1000, 60, func(i int) bool { return i%30 == 0 })
+		if err := validateTsChunk("test.ts", data); err != nil {
+			t.Fatal(err)
+		}
+		var video, audio, keyframes int
+		for _, u := range testDemux(t, data) {
+			if !u.complete {
+				t.Fatalf("incomplete PES packet on PID %v", u.pid)
+			}
+			switch u.pid {
+			case testVideoPid:
+				if u.streamType != streamType || u.pts != 1000+int64(video)*testFrameTicks {
+					t.Errorf("video frame %v: stream type %v, pts %v", video, u.streamType, u.pts)
+				}
+				if isKeyframe(u) {
+					keyframes++
+				}
+				video++
+			case testAudioPid:
+				if _, err := parseAdtsHeader(u.data); err != nil || u.pts != 1000+int64(audio)*testAudioTicks {
+					t.Errorf("audio frame %v: pts %v, %v", audio, u.pts, err)
+				}
+				audio++
+			}
+		}
+		if video != 60 || keyframes != 2 || audio != 94 {
+			t.Errorf("stream type %v: %v video frames, %v keyframes, %v audio frames", streamType, video, keyframes, audio)
+		}
+	}
+}
+
+func TestH264SpsSynthetic(t *testing.T) {
+	sps, err := parseH264Sps(testH264Sps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sps.width != 320 || sps.height != 240 {
+		t.Errorf("%vx%v instead of 320x240", sps.width, sps.height)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import "iter"
+
+// H.264 NAL unit types
+const (
+	h264NalIdr = 5
+	h264NalSps = 7
+	h264NalPps = 8
+	h264NalAud = 9
+)
+
+// Iterate over the NAL units of an Annex B byte stream (without start codes)
+func annexBNalUnits(data []byte) iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		start := -1
+		i := 0
+		for i+2 < len(data) {
+			if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+				if start >= 0 {
+					// a 4 byte start code has one more zero byte
+					end := i
+					for end > start && data[end-1] == 0 {
+						end--
+					}
+					if !yield(data[start:end]) {
+						return
+					}
+				}
+				i += 3
+				start = i
+				continue
+			}
+			i++
+		}
+		if start >= 0 && start < len(data) {
+			yield(data[start:])
+		}
+	}
+}
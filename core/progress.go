@@ -0,0 +1,71 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"math"
+	"time"
+)
+
+// Collects the statistics of a download for DownloadProgress
+type progressTracker struct {
+	ep         *StreamEpisode
+	chunklist  *ChunkList
+	bandwidth  int
+	start      time.Time
+	firstChunk int           // the download (re)started at this chunk
+	delayed    time.Duration // simulated buffering
+	chunks     int           // downloaded since start
+	bytes      int64
+}
+
+func newProgressTracker(ep *StreamEpisode, chunklist *ChunkList, format *VideoFormat, firstChunk int) *progressTracker {
+	return &progressTracker{ep: ep, chunklist: chunklist, bandwidth: format.Bandwidth, start: time.Now(), firstChunk: firstChunk}
+}
+
+func (t *progressTracker) downloaded(size int) {
+	t.chunks++
+	t.bytes += int64(size)
+}
+
+func (t *progressTracker) fill(p *DownloadProgress, state *DownloadState) {
+	chunks := t.chunklist.Chunks
+	p.ChunksDone, p.ChunksTotal = state.NextChunk, len(chunks)
+	p.BytesWritten = state.CommittedSize
+	p.Live = t.chunklist.Live
+	if len(chunks) == 0 {
+		return
+	}
+	p.Position = chunks[0].Start
+	if state.NextChunk > 0 {
+		last := chunks[min(state.NextChunk, len(chunks))-1]
+		p.Position = last.Start + last.Duration
+	}
+	p.Chapter = t.ep.ChapterAt(p.Position)
+	elapsed := time.Since(t.start)
+	if elapsed > 0 {
+		p.AverageRate = float64(t.bytes) / elapsed.Seconds()
+	}
+	p.Eta = -1
+	if p.Live {
+		// the size and the duration are unknown
+		return
+	}
+	// the size of the written data so far, or the announced bandwidth
+	last := chunks[len(chunks)-1]
+	duration := last.Start + last.Duration - chunks[0].Start
+	written := p.Position - chunks[0].Start
+	if written > 0 && state.CommittedSize > 0 {
+		p.EstimatedSize = int64(float64(state.CommittedSize) * duration.Seconds() / written.Seconds())
+	} else if t.bandwidth > 0 {
+		p.EstimatedSize = int64(float64(t.bandwidth) / 8 * duration.Seconds())
+	}
+	transferTime := (elapsed - t.delayed).Seconds()
+	if t.chunks > 0 && transferTime > 0 {
+		remaining := float64(len(chunks)-t.firstChunk-t.chunks) * float64(t.bytes) / float64(t.chunks)
+		downloadTime := max(remaining, 0) / (float64(t.bytes) / transferTime)
+		// the buffering is simulated after every RatelimitDelayAfter seconds
+		delays := math.Floor(downloadTime/RatelimitDelayAfter) * RatelimitDelay
+		p.Eta = time.Duration((downloadTime + delays) * float64(time.Second))
+	}
+}
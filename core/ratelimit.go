@@ -0,0 +1,61 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const RatelimitBurst = 1_000_000 // in Bytes; default burst size of the token bucket
+
+// A token bucket rate limiter (bytes per second). A single RateLimiter
+// can be shared by multiple downloads to cap the total download rate.
+// A rate <= 0 doesn't limit the transfer.
+type RateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (rl *RateLimiter) Rate() float64 {
+	return rl.rate
+}
+
+// Wait until n bytes may be transferred or ctx is done.
+func (rl *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if rl.rate <= 0 {
+		return ctx.Err()
+	}
+	rl.mutex.Lock()
+	now := time.Now()
+	rl.tokens = min(rl.burst, rl.tokens+now.Sub(rl.last).Seconds()*rl.rate)
+	rl.last = now
+	// Take the tokens in advance, the debt is paid by waiting. This
+	// keeps the order of concurrent callers fair.
+	rl.tokens -= float64(n)
+	var wait time.Duration
+	if rl.tokens < 0 {
+		wait = time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+	}
+	rl.mutex.Unlock()
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	if !sleepCtx(ctx, wait) {
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int           // including the first attempt
+	BaseDelay   time.Duration // delay before the first retry, doubles with every retry
+	MaxDelay    time.Duration
+}
+
+// Used where no policy is specified (MaxAttempts is 0)
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: MaxRetries + 1,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+func (p RetryPolicy) orDefault() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		return DefaultRetryPolicy
+	}
+	return p
+}
+
+// The delay before the nth retry, with jitter
+func (p RetryPolicy) delay(retry int, err error) time.Duration {
+	var statusErr *HttpStatusCodeError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter
+	}
+	d := p.BaseDelay
+	for i := 1; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxDelay)
+	if d <= 0 {
+		return 0
+	}
+	// somewhere between d/2 and d
+	return d/2 + rand.N(d/2+1)
+}
+
+// Call fn until it succeeds, fails permanently, the attempts are
+// exhausted or ctx is done. onRetry (optional) is called before
+// waiting for the next attempt.
+func (p RetryPolicy) do(ctx context.Context, fn func() error, onRetry func(retry int, err error)) error {
+	var err error
+	for retry := 0; ; retry++ {
+		err = fn()
+		if err == nil || ctx.Err() != nil || isPermanentError(err) || retry+1 >= max(p.MaxAttempts, 1) {
+			return err
+		}
+		if onRetry != nil {
+			onRetry(retry+1, err)
+		}
+		if !sleepCtx(ctx, p.delay(retry+1, err)) {
+			return err
+		}
+	}
+}
+
+func isPermanentError(err error) bool {
+	var statusErr *HttpStatusCodeError
+	if errors.As(err, &statusErr) {
+		return statusErr.Permanent()
+	}
+	var encryptionErr *EncryptionUnsupportedError
+	return errors.As(err, &encryptionErr)
+}
+
+func httpGetRetry(ctx context.Context, policy RetryPolicy, url string, additionalHeaders http.Header, timeout time.Duration, limiter *RateLimiter) ([]byte, error) {
+	var data []byte
+	err := policy.do(ctx, func() error {
+		var err error
+		data, err = httpGet(ctx, url, additionalHeaders, timeout, limiter)
+		return err
+	}, nil)
+	return data, err
+}
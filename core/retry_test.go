@@ -0,0 +1,51 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStreamChunkListRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		policy   RetryPolicy
+		requests int32
+	}{
+		{"single attempt", http.StatusServiceUnavailable, RetryPolicy{MaxAttempts: 1}, 1},
+		{"three attempts", http.StatusServiceUnavailable, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, 3},
+		{"permanent error", http.StatusNotFound, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, 1},
+	}
+	// the policies of concurrent requests don't affect each other
+	var wg sync.WaitGroup
+	for _, tt := range tests {
+		requests := &atomic.Int32{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(tt.status)
+		}))
+		defer srv.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			format := VideoFormat{Name: "720p", Url: srv.URL + "/720p.m3u8"}
+			_, err := format.StreamChunkList(context.Background(), tt.policy)
+			var statusErr *HttpStatusCodeError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+				t.Errorf("%v: expected status %v, got %v", tt.name, tt.status, err)
+			}
+			if n := requests.Load(); n != tt.requests {
+				t.Errorf("%v: %v requests instead of %v", tt.name, n, tt.requests)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Receives the data of a download, chunk by chunk and in order
+type Sink interface {
+	// Prepare the sink. offset is the size of the data committed by a
+	// previous run of the download, everything after it has to be
+	// discarded. 0 starts a new download, -1 continues after all data
+	// that is already there. Returns the offset the download continues
+	// at.
+	Open(offset int64) (int64, error)
+	// Append the data of a chunk. This isn't necessarily the data as it
+	// was downloaded, e.g. if it was trimmed or converted.
+	WriteChunk(chunk Chunk, data []byte) error
+	// Make the written data durable. Called before the download state is
+	// updated.
+	Commit() error
+	// complete is false if the download was aborted or failed
+	Close(complete bool) error
+}
+
+// Writes into a file, by default into <Filename>.part, which is renamed
+// when the download is complete. Sinks implementing io.WriterAt can be
+// updated afterwards, e.g. to write the duration of MP4 files.
+type FileSink struct {
+	Filename   string
+	NoPartFile bool
+	Overwrite  bool
+	// the container to remux into when the download is complete, see
+	// remuxOutput()
+	remux    string
+	file     *os.File
+	filename string // the file that is actually written
+	offset   int64
+}
+
+func NewFileSink(filename string, noPartFile bool, overwrite bool) *FileSink {
+	return &FileSink{Filename: filename, NoPartFile: noPartFile, Overwrite: overwrite}
+}
+
+func (s *FileSink) Open(offset int64) (int64, error) {
+	s.filename = s.Filename + ".part"
+	previousFilename := s.Filename
+	if s.remux != "" {
+		s.filename = s.Filename + ".ts.part"
+		previousFilename = s.filename
+	} else if s.NoPartFile {
+		s.filename, previousFilename = previousFilename, s.filename
+	}
+	if offset == 0 && !s.Overwrite {
+		if _, err := os.Stat(s.Filename); err == nil {
+			return 0, &FileExistsError{Filename: s.Filename}
+		}
+	}
+	if offset != 0 {
+		// continue downloads that were started with(out) a .part file
+		if _, err := os.Stat(s.filename); os.IsNotExist(err) {
+			if _, err := os.Stat(previousFilename); err == nil {
+				err = os.Rename(previousFilename, s.filename)
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	var err error
+	s.file, err = os.OpenFile(s.filename, os.O_RDWR|os.O_CREATE, 0660)
+	if err != nil {
+		return 0, err
+	}
+	// Drop everything after the last committed chunk, this could be
+	// a partially written chunk or one that was written before the
+	// process got killed but not recorded in the info file.
+	if offset < 0 {
+		offset, err = s.file.Seek(0, io.SeekEnd)
+	} else {
+		var fileInfo os.FileInfo
+		fileInfo, err = s.file.Stat()
+		if err == nil && fileInfo.Size() < offset {
+			err = &OutputFileTruncatedError{Filename: s.filename, Size: fileInfo.Size(), Expected: offset}
+		}
+		if err == nil {
+			err = s.file.Truncate(offset)
+		}
+	}
+	s.offset = offset
+	return offset, err
+}
+
+func (s *FileSink) WriteChunk(chunk Chunk, data []byte) error {
+	n, err := s.file.WriteAt(data, s.offset)
+	s.offset += int64(n)
+	return err
+}
+
+func (s *FileSink) WriteAt(p []byte, off int64) (int, error) {
+	return s.file.WriteAt(p, off)
+}
+
+func (s *FileSink) Commit() error {
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close(complete bool) error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	if err != nil || !complete {
+		return err
+	}
+	if s.remux != "" {
+		// the output file was already created by remuxOutput()
+		return os.Remove(s.filename)
+	}
+	if s.filename != s.Filename {
+		err = os.Rename(s.filename, s.Filename)
+		if err == nil {
+			err = syncDir(filepath.Dir(s.Filename))
+		}
+	}
+	return err
+}
+
+// Remux the downloaded transport stream into the output file
+func (s *FileSink) remuxOutput(ctx context.Context) error {
+	return remuxFile(ctx, s.file, s.Filename, s.remux)
+}
+
+// Writes into an io.Writer, e.g. os.Stdout. Downloads into a WriterSink
+// can't be continued.
+type WriterSink struct {
+	Writer io.Writer
+}
+
+func NewStdoutSink() *WriterSink {
+	return &WriterSink{Writer: os.Stdout}
+}
+
+func (s *WriterSink) Open(offset int64) (int64, error) {
+	if offset != 0 {
+		return 0, &SinkNotResumableError{}
+	}
+	return 0, nil
+}
+
+func (s *WriterSink) WriteChunk(chunk Chunk, data []byte) error {
+	_, err := s.Writer.Write(data)
+	return err
+}
+
+func (s *WriterSink) Commit() error {
+	if f, ok := s.Writer.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (s *WriterSink) Close(complete bool) error {
+	return s.Commit()
+}
+
+// Writes into several sinks at once
+type TeeSink struct {
+	Sinks []Sink
+}
+
+func NewTeeSink(sinks ...Sink) *TeeSink {
+	return &TeeSink{Sinks: sinks}
+}
+
+// All sinks have to continue at the same offset
+func (s *TeeSink) Open(offset int64) (int64, error) {
+	result := int64(-1)
+	for _, sink := range s.Sinks {
+		o, err := sink.Open(offset)
+		if err != nil {
+			return 0, err
+		}
+		if result >= 0 && o != result {
+			return 0, &SinkOffsetMismatchError{Offset: o, Expected: result}
+		}
+		result = o
+	}
+	return max(result, 0), nil
+}
+
+func (s *TeeSink) WriteChunk(chunk Chunk, data []byte) error {
+	for _, sink := range s.Sinks {
+		if err := sink.WriteChunk(chunk, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Only writes into the sinks that implement io.WriterAt
+func (s *TeeSink) WriteAt(p []byte, off int64) (int, error) {
+	for _, sink := range s.Sinks {
+		if w, ok := sink.(io.WriterAt); ok {
+			if _, err := w.WriteAt(p, off); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (s *TeeSink) Commit() error {
+	for _, sink := range s.Sinks {
+		if err := sink.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Closes all sinks, even if one of them fails
+func (s *TeeSink) Close(complete bool) error {
+	var err error
+	for _, sink := range s.Sinks {
+		if e := sink.Close(complete); err == nil {
+			err = e
+		}
+	}
+	return err
+}
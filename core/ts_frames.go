@@ -0,0 +1,220 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+// Splits an MPEG transport stream into the frames of its H.264, H.265 and
+// AAC streams, as needed to remux it into another container
+
+type mediaTrack struct {
+	pid   uint16
+	video bool
+	// set as soon as the codec configuration is known
+	configured bool
+	// H.264 or H.265
+	hevc   bool
+	vps    []byte // H.265 only
+	sps    []byte
+	pps    []byte
+	width  int
+	height int
+	// AAC
+	audioConfig []byte // AudioSpecificConfig
+	sampleRate  int
+	channels    int
+}
+
+type mediaFrame struct {
+	track    *mediaTrack
+	pts      int64 // 90 kHz, without 33 bit wraps
+	dts      int64
+	duration int64 // 0 if unknown
+	keyframe bool
+	data     []byte // Annex B for video, raw frames for AAC
+}
+
+type tsFrameReader struct {
+	demuxer *tsDemuxer
+	tracks  map[uint16]*mediaTrack
+	onFrame func(*mediaFrame)
+	buf     []byte
+	// to unwrap the timestamps
+	clockInit bool
+	lastRaw   int64
+	last      int64
+}
+
+// onFrame is called for every frame, in order per track. Video frames
+// start with the first keyframe that comes with the parameter sets.
+func newTsFrameReader(onFrame func(*mediaFrame)) *tsFrameReader {
+	r := &tsFrameReader{tracks: map[uint16]*mediaTrack{}, onFrame: onFrame}
+	r.demuxer = newTsDemuxer(r.onPes)
+	return r
+}
+
+func (r *tsFrameReader) Write(p []byte) (int, error) {
+	r.buf = append(r.buf, p...)
+	i := 0
+	for i+tsPacketSize <= len(r.buf) {
+		if r.buf[i] != tsSyncByte {
+			// resync
+			i++
+			continue
+		}
+		r.demuxer.push(r.buf[i : i+tsPacketSize])
+		i += tsPacketSize
+	}
+	r.buf = append(r.buf[:0], r.buf[i:]...)
+	return len(p), nil
+}
+
+// Emit the remaining frames
+func (r *tsFrameReader) flush() {
+	r.demuxer.flush()
+}
+
+// All supported streams of the PMT have a configured track
+func (r *tsFrameReader) allConfigured() bool {
+	found := false
+	for pid, streamType := range r.demuxer.streams {
+		if !isVideoStreamType(streamType) && streamType != tsStreamTypeAac {
+			continue
+		}
+		if t, ok := r.tracks[pid]; !ok || !t.configured {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// Continue the 33 bit timestamps over wraps. All streams share the same
+// clock, so timestamps of different tracks stay comparable.
+func (r *tsFrameReader) unwrap(ts int64) int64 {
+	if !r.clockInit {
+		r.clockInit = true
+		r.lastRaw, r.last = ts, ts
+		return ts
+	}
+	r.last += ptsDelta(ts, r.lastRaw)
+	r.lastRaw = ts
+	return r.last
+}
+
+func (r *tsFrameReader) track(u *pesUnit) *mediaTrack {
+	t, ok := r.tracks[u.pid]
+	if !ok {
+		t = &mediaTrack{pid: u.pid, video: isVideoStreamType(u.streamType), hevc: u.streamType == tsStreamTypeHevc}
+		r.tracks[u.pid] = t
+	}
+	return t
+}
+
+func (r *tsFrameReader) onPes(u *pesUnit) {
+	if !u.complete || u.pts < 0 || len(u.data) == 0 {
+		return
+	}
+	switch u.streamType {
+	case tsStreamTypeH264, tsStreamTypeHevc:
+		r.onVideo(u)
+	case tsStreamTypeAac:
+		r.onAac(u)
+	}
+}
+
+func (r *tsFrameReader) onVideo(u *pesUnit) {
+	t := r.track(u)
+	keyframe := isKeyframe(u)
+	if !t.configured {
+		if !keyframe || !t.configure(u.data) {
+			return
+		}
+	}
+	dts := r.unwrap(u.decodeTime())
+	pts := dts + ptsDelta(u.pts, u.decodeTime())
+	r.onFrame(&mediaFrame{track: t, pts: pts, dts: dts, keyframe: keyframe, data: u.data})
+}
+
+// Take the parameter sets of a video track from a keyframe
+func (t *mediaTrack) configure(data []byte) bool {
+	var vps, sps, pps []byte
+	for nalu := range annexBNalUnits(data) {
+		if len(nalu) < 2 {
+			continue
+		}
+		if t.hevc {
+			switch hevcNalType(nalu) {
+			case hevcNalVps:
+				vps = nalu
+			case hevcNalSps:
+				sps = nalu
+			case hevcNalPps:
+				pps = nalu
+			}
+			continue
+		}
+		switch nalu[0] & 0x1f {
+		case h264NalSps:
+			sps = nalu
+		case h264NalPps:
+			pps = nalu
+		}
+	}
+	if sps == nil || pps == nil || (t.hevc && vps == nil) {
+		return false
+	}
+	if t.hevc {
+		info, err := parseHevcSps(sps)
+		if err != nil {
+			return false
+		}
+		t.width, t.height = info.width, info.height
+		t.vps = append([]byte{}, vps...)
+	} else {
+		info, err := parseH264Sps(sps)
+		if err != nil {
+			return false
+		}
+		t.width, t.height = info.width, info.height
+	}
+	t.sps, t.pps = append([]byte{}, sps...), append([]byte{}, pps...)
+	t.configured = true
+	return true
+}
+
+// The AVCDecoderConfigurationRecord or HEVCDecoderConfigurationRecord
+func (t *mediaTrack) decoderConfig() []byte {
+	if t.hevc {
+		return hevcDecoderConfig(t.vps, t.sps, t.pps)
+	}
+	return avcDecoderConfig(t.sps, t.pps)
+}
+
+// Convert the Annex B data of a video frame for Matroska and MP4
+func (t *mediaTrack) lengthPrefixed(data []byte) []byte {
+	if t.hevc {
+		return annexBToLengthPrefixed(data, isHevcDelimiter)
+	}
+	return annexBToLengthPrefixed(data, isH264Delimiter)
+}
+
+func (r *tsFrameReader) onAac(u *pesUnit) {
+	t := r.track(u)
+	pts := r.unwrap(u.pts)
+	i := int64(0)
+	for h, frame := range adtsFrames(u.data) {
+		if !t.configured {
+			t.audioConfig = h.audioSpecificConfig()
+			t.sampleRate = h.sampleRate()
+			t.channels = h.channelConfig
+			if t.channels == 0 {
+				t.channels = 2 // defined in the bitstream, assume stereo
+			}
+			t.configured = true
+		}
+		// computed per frame, so rounding errors don't add up
+		start := pts + i*aacSamplesPerFrame*tsClockRate/int64(t.sampleRate)
+		end := pts + (i+1)*aacSamplesPerFrame*tsClockRate/int64(t.sampleRate)
+		r.onFrame(&mediaFrame{track: t, pts: start, dts: start, duration: end - start, keyframe: true, data: frame})
+		i++
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import "time"
+
+// Drop the PES packets of a TS chunk that are outside of [from, to]
+// (relative to the beginning of the chunk, -1 to keep everything). The
+// video starts at the last keyframe before from, so the first GOP stays
+// decodable. If there is no such keyframe, the video starts at the
+// beginning of the chunk and imprecise is true. PSI packets are always
+// kept.
+func trimTsChunk(data []byte, from time.Duration, to time.Duration) (trimmed []byte, imprecise bool, err error) {
+	if len(data)%tsPacketSize != 0 {
+		return data, false, &TsParseError{Msg: "chunk size is not a multiple of the packet size"}
+	}
+	units := []*pesUnit{}
+	demuxer := newTsDemuxer(func(u *pesUnit) {
+		units = append(units, u)
+	})
+	numPackets := len(data) / tsPacketSize
+	for i := range numPackets {
+		if err := demuxer.push(data[i*tsPacketSize : (i+1)*tsPacketSize]); err != nil {
+			return data, false, err
+		}
+	}
+	demuxer.flush()
+	// the earliest presentation time is the beginning of the chunk
+	var base int64 = -1
+	videoPid := -1
+	for _, u := range units {
+		if u.pts >= 0 && (base < 0 || ptsDelta(u.pts, base) < 0) {
+			base = u.pts
+		}
+		if videoPid < 0 && isVideoStreamType(u.streamType) {
+			videoPid = int(u.pid)
+		}
+	}
+	if base < 0 {
+		return data, false, &TsParseError{Msg: "no timestamps found"}
+	}
+	toTicks := func(d time.Duration) int64 {
+		return int64(d.Seconds() * tsClockRate)
+	}
+	drop := make([]bool, numPackets)
+	dropUnit := func(u *pesUnit) {
+		for _, i := range u.packets {
+			drop[i] = true
+		}
+	}
+	if from >= 0 {
+		start := toTicks(from)
+		// find the keyframe to start with
+		var keyframe *pesUnit
+		for _, u := range units {
+			if int(u.pid) != videoPid || !u.complete {
+				continue
+			}
+			if ptsDelta(u.pts, base) > start {
+				break
+			}
+			if isKeyframe(u) {
+				keyframe = u
+			}
+		}
+		// e.g. the GOP started in the previous chunk
+		imprecise = videoPid >= 0 && keyframe == nil
+		for _, u := range units {
+			if int(u.pid) == videoPid {
+				if keyframe != nil && u.packets[0] < keyframe.packets[0] {
+					dropUnit(u)
+				}
+			} else if !u.complete || ptsDelta(u.pts, base) < start {
+				dropUnit(u)
+			}
+		}
+	}
+	if to >= 0 {
+		stop := toTicks(to)
+		// everything after the first PES packet past the stop timestamp
+		// (in decoding order), per stream
+		stopped := map[uint16]bool{}
+		for _, u := range units {
+			if !stopped[u.pid] && u.complete && ptsDelta(u.decodeTime(), base) > stop {
+				stopped[u.pid] = true
+			}
+			if stopped[u.pid] {
+				dropUnit(u)
+			}
+		}
+	}
+	trimmed = make([]byte, 0, len(data))
+	for i := range numPackets {
+		if !drop[i] {
+			trimmed = append(trimmed, data[i*tsPacketSize:(i+1)*tsPacketSize]...)
+		}
+	}
+	return trimmed, imprecise, nil
+}
+
+// Trim the chunk with the index i, if it is the first or last chunk
+// of the (cut) chunk list. See trimTsChunk
+func trimChunkAt(chunklist *ChunkList, i int, data []byte, startOffset time.Duration, stopOffset time.Duration) ([]byte, bool, error) {
+	chunk := chunklist.Chunks[i]
+	from := time.Duration(-1)
+	to := time.Duration(-1)
+	if i == 0 && startOffset > chunk.Start {
+		from = startOffset - chunk.Start
+	}
+	if i == len(chunklist.Chunks)-1 && stopOffset >= 0 && stopOffset < chunk.Start+chunk.Duration {
+		to = max(stopOffset-chunk.Start, 0)
+	}
+	if from < 0 && to < 0 {
+		return data, false, nil
+	}
+	return trimTsChunk(data, from, to)
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func testKeyframes(keyframes ...int) func(i int) bool {
+	return func(i int) bool { return slices.Contains(keyframes, i) }
+}
+
+func TestTrimTsChunk(t *testing.T) {
+	const base = 10 * tsClockRate
+	tests := []struct {
+		name       string
+		streamType uint8
+		keyframe   func(i int) bool
+		from, to   time.Duration
+		first      int // the index of the first and last video frame left
+		last       int
+		imprecise  bool
+	}{
+		{"start after keyframe", tsStreamTypeH264, testKeyframes(0, 30), 1500 * time.Millisecond, -1, 30, 59, false},
+		{"start at keyframe", tsStreamTypeH264, testKeyframes(0, 30), time.Second, -1, 30, 59, false},
+		{"start in first gop", tsStreamTypeH264, testKeyframes(0, 30), 500 * time.Millisecond, -1, 0, 59, false},
+		{"stop", tsStreamTypeH264, testKeyframes(0, 30), -1, time.Second, 0, 30, false},
+		{"start and stop", tsStreamTypeH264, testKeyframes(0, 30), 500 * time.Millisecond, 1500 * time.Millisecond, 0, 45, false},
+		// the gop started in the previous chunk
+		{"no keyframe", tsStreamTypeH264, testKeyframes(), time.Second, -1, 0, 59, true},
+		{"keyframe after start", tsStreamTypeH264, testKeyframes(45), time.Second, -1, 0, 59, true},
+		{"hevc", tsStreamTypeHevc, testKeyframes(0, 30), 1500 * time.Millisecond, -1, 30, 59, false},
+		{"hevc keyframe after start", tsStreamTypeHevc, testKeyframes(45), time.Second, -1, 0, 59, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestTsWriter(tt.streamType)
+			data := w.chunk(base, 60, tt.keyframe)
+			trimmed, imprecise, err := trimTsChunk(data, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if imprecise != tt.imprecise {
+				t.Errorf("imprecise is %v", imprecise)
+			}
+			var video []*pesUnit
+			var audioStart, audioEnd int64 = -1, -1
+			for _, u := range testDemux(t, trimmed) {
+				if !u.complete {
+					t.Fatalf("incomplete PES packet on PID %v", u.pid)
+				}
+				if u.pid == testVideoPid {
+					video = append(video, u)
+				} else {
+					if audioStart < 0 {
+						audioStart = u.pts
+					}
+					audioEnd = u.pts
+				}
+			}
+			if len(video) == 0 {
+				t.Fatal("no video left")
+			}
+			first, last := (video[0].pts-base)/testFrameTicks, (video[len(video)-1].pts-base)/testFrameTicks
+			if int(first) != tt.first || int(last) != tt.last || len(video) != tt.last-tt.first+1 {
+				t.Errorf("video frames %v to %v (%v) instead of %v to %v", first, last, len(video), tt.first, tt.last)
+			}
+			if !tt.imprecise && tt.from >= 0 && !isKeyframe(video[0]) {
+				t.Error("the video doesn't start with a keyframe")
+			}
+			// the audio is cut precisely
+			if start := int64(tt.from.Seconds() * tsClockRate); tt.from >= 0 && (audioStart-base < start || audioStart-base >= start+testAudioTicks) {
+				t.Errorf("the audio starts at %v instead of %v", audioStart-base, start)
+			}
+			if stop := int64(tt.to.Seconds() * tsClockRate); tt.to >= 0 && (audioEnd-base > stop || audioEnd-base <= stop-testAudioTicks) {
+				t.Errorf("the audio stops at %v instead of %v", audioEnd-base, stop)
+			}
+			// no gaps in the continuity counters, also not to the next chunk
+			// unless it is the last one
+			if tt.to < 0 {
+				trimmed = append(trimmed, w.chunk(base+60*testFrameTicks, 60, testKeyframes(0))...)
+			}
+			if err := validateTsChunk("trimmed.ts", trimmed); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTrimTsChunkErrors(t *testing.T) {
+	data := newTestTsWriter(tsStreamTypeH264).chunk(0, 10, testKeyframes(0))
+	if _, _, err := trimTsChunk(data[:len(data)-1], time.Second, -1); err == nil {
+		t.Error("a truncated chunk was trimmed")
+	}
+	if _, _, err := trimTsChunk(data[:2*tsPacketSize], 0, -1); err == nil {
+		t.Error("a chunk without timestamps was trimmed")
+	}
+}
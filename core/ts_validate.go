@@ -0,0 +1,59 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import "fmt"
+
+const tsPidNull = 0x1fff
+
+// Checks the continuity counter of a packet against the previous packet
+// of the same PID in last. Duplicate packets and signalled
+// discontinuities are allowed.
+func tsContinuityOk(last map[uint16]uint8, p *tsPacket) bool {
+	if p.pid == tsPidNull {
+		return true
+	}
+	prev, seen := last[p.pid]
+	last[p.pid] = p.cc
+	switch {
+	case !seen || p.discontinuity:
+		return true
+	case !p.hasPayload:
+		// the counter only increments with a payload
+		return p.cc == prev
+	default:
+		return p.cc == (prev+1)&0x0f || p.cc == prev
+	}
+}
+
+// Check that a downloaded chunk is a complete transport stream: whole
+// packets with sync bytes, a PAT and a PMT and no gaps in the continuity
+// counters
+func validateTsChunk(url string, data []byte) error {
+	invalid := func(format string, a ...any) error {
+		return &ChunkValidationError{Url: url, Msg: fmt.Sprintf(format, a...)}
+	}
+	if len(data) == 0 || len(data)%tsPacketSize != 0 {
+		return invalid("the size (%v bytes) is not a multiple of %v bytes", len(data), tsPacketSize)
+	}
+	demuxer := newTsDemuxer(func(*pesUnit) {})
+	last := map[uint16]uint8{}
+	for i := 0; i < len(data); i += tsPacketSize {
+		p, err := parseTsPacket(data[i : i+tsPacketSize])
+		if err != nil {
+			return invalid("packet %v: %v", i/tsPacketSize, err.(*TsParseError).Msg)
+		}
+		prev := last[p.pid]
+		if !tsContinuityOk(last, &p) {
+			return invalid("packet %v: continuity counter of PID %v jumps from %v to %v", i/tsPacketSize, p.pid, prev, p.cc)
+		}
+		demuxer.push(data[i : i+tsPacketSize])
+	}
+	if len(demuxer.pmtPids) == 0 {
+		return invalid("no PAT found")
+	}
+	if len(demuxer.streams) == 0 {
+		return invalid("no PMT found")
+	}
+	return nil
+}
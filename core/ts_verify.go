@@ -0,0 +1,152 @@
+// Copyright (c) 2025, Julian Müller (ChaoticByte)
+
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Kinds of TsIssue
+const (
+	TsIssueSyncLoss   = "sync_loss"
+	TsIssuePacket     = "invalid_packet"
+	TsIssueContinuity = "continuity"
+	TsIssueTimestamp  = "timestamp"
+	TsIssueDuration   = "duration"
+)
+
+// Only the first issues are listed in a TsReport, all are counted
+const TsMaxReportedIssues = 100
+
+// Timestamps of a stream must not jump further than this
+const tsMaxTimestampGap = tsClockRate
+
+// The verified duration may be a bit shorter than expected, e.g. because
+// the expected duration is rounded
+const TsDurationTolerance = 2 * time.Second
+
+type TsIssue struct {
+	Kind   string `json:"kind"`
+	Offset int64  `json:"offset"` // in bytes
+	Pid    uint16 `json:"pid,omitempty"`
+	Msg    string `json:"message"`
+}
+
+// The result of VerifyTs. Durations are in nanoseconds.
+type TsReport struct {
+	Size             int64         `json:"size"`
+	Packets          int64         `json:"packets"`
+	Duration         time.Duration `json:"duration"`
+	ExpectedDuration time.Duration `json:"expected_duration,omitempty"`
+	SyncLosses       int           `json:"sync_losses"`
+	InvalidPackets   int           `json:"invalid_packets"`
+	ContinuityErrors int           `json:"continuity_errors"`
+	TimestampErrors  int           `json:"timestamp_errors"`
+	Issues           []TsIssue     `json:"issues"`
+}
+
+func (r *TsReport) Ok() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *TsReport) addIssue(issue TsIssue) {
+	if len(r.Issues) < TsMaxReportedIssues {
+		r.Issues = append(r.Issues, issue)
+	}
+}
+
+// Scan a transport stream for sync loss, gaps in the continuity counters
+// and discontinuous timestamps. The duration is the length of the
+// longest audio or video stream without the discontinuities. If expected
+// is greater than 0, it's also checked against the duration.
+func VerifyTs(r io.Reader, expected time.Duration) (TsReport, error) {
+	report := TsReport{Issues: []TsIssue{}, ExpectedDuration: expected}
+	var offset int64
+	lastTimestamps := map[uint16]int64{}
+	durations := map[uint16]int64{}
+	demuxer := newTsDemuxer(func(u *pesUnit) {
+		t := u.decodeTime()
+		if t < 0 || !(isVideoStreamType(u.streamType) || u.streamType == tsStreamTypeAac) {
+			return
+		}
+		last, ok := lastTimestamps[u.pid]
+		lastTimestamps[u.pid] = t
+		if !ok {
+			durations[u.pid] = 0
+			return
+		}
+		d := ptsDelta(t, last)
+		if d <= 0 || d > tsMaxTimestampGap {
+			report.TimestampErrors++
+			report.addIssue(TsIssue{Kind: TsIssueTimestamp, Offset: offset, Pid: u.pid,
+				Msg: fmt.Sprintf("the timestamp jumps by %v", tsDuration(d))})
+			return
+		}
+		durations[u.pid] += d
+	})
+	br := bufio.NewReaderSize(r, 1<<20)
+	inSync := true
+	lastCc := map[uint16]uint8{}
+	for {
+		b, err := br.Peek(tsPacketSize)
+		if len(b) < tsPacketSize {
+			if err != nil && err != io.EOF {
+				return report, err
+			}
+			if len(b) > 0 {
+				report.SyncLosses++
+				report.addIssue(TsIssue{Kind: TsIssueSyncLoss, Offset: offset, Msg: fmt.Sprintf("incomplete packet (%v bytes) at the end", len(b))})
+				offset += int64(len(b))
+			}
+			break
+		}
+		if b[0] != tsSyncByte {
+			if inSync {
+				report.SyncLosses++
+				report.addIssue(TsIssue{Kind: TsIssueSyncLoss, Offset: offset, Msg: "sync byte missing"})
+				inSync = false
+			}
+			br.Discard(1)
+			offset++
+			continue
+		}
+		inSync = true
+		report.Packets++
+		p, err := parseTsPacket(b)
+		if err != nil {
+			report.InvalidPackets++
+			report.addIssue(TsIssue{Kind: TsIssuePacket, Offset: offset, Msg: err.(*TsParseError).Msg})
+		} else {
+			prev := lastCc[p.pid]
+			if !tsContinuityOk(lastCc, &p) {
+				report.ContinuityErrors++
+				report.addIssue(TsIssue{Kind: TsIssueContinuity, Offset: offset, Pid: p.pid,
+					Msg: fmt.Sprintf("the continuity counter jumps from %v to %v", prev, p.cc)})
+			}
+			demuxer.push(b)
+		}
+		br.Discard(tsPacketSize)
+		offset += tsPacketSize
+	}
+	demuxer.flush()
+	report.Size = offset
+	var longest int64
+	for _, d := range durations {
+		longest = max(longest, d)
+	}
+	report.Duration = tsDuration(longest)
+	if len(durations) == 0 {
+		report.addIssue(TsIssue{Kind: TsIssueDuration, Offset: offset, Msg: "no audio or video timestamps found"})
+	} else if expected > 0 && report.Duration < expected-TsDurationTolerance {
+		report.addIssue(TsIssue{Kind: TsIssueDuration, Offset: offset,
+			Msg: fmt.Sprintf("%v of %v are missing", (expected - report.Duration).Round(time.Second), expected)})
+	}
+	return report, nil
+}
+
+func tsDuration(ticks int64) time.Duration {
+	return time.Duration(float64(ticks) / tsClockRate * float64(time.Second))
+}